@@ -0,0 +1,138 @@
+// Package analytics holds the rules shared by every implementation of the dashboard
+// statistics: age bands, period boundaries and filling gaps in the registration series.
+package analytics
+
+import (
+	"go2/model"
+	"sort"
+	"time"
+)
+
+type AgeBand struct {
+	Label string
+	Min   int // inclusive
+	Max   int // exclusive
+}
+
+var AgeBands = []AgeBand{
+	{"Under 18", 0, 18},
+	{"18-24", 18, 25},
+	{"25-34", 25, 35},
+	{"35-44", 35, 45},
+	{"45-54", 45, 55},
+	{"55-64", 55, 65},
+	{"65+", 65, 150},
+}
+
+// UnknownAge is the band of users without a valid date of birth
+const UnknownAge = "Unknown"
+
+// AgeBandOf returns the band label for a DOB in the 2006-01-02 format
+func AgeBandOf(dob string, now time.Time) string {
+	birth, err := time.Parse("2006-01-02", dob)
+	if err != nil {
+		return UnknownAge
+	}
+	age := now.Year() - birth.Year()
+	if now.Month() < birth.Month() || now.Month() == birth.Month() && now.Day() < birth.Day() {
+		age-- // birthday not reached yet this year
+	}
+	for _, band := range AgeBands {
+		if age >= band.Min && age < band.Max {
+			return band.Label
+		}
+	}
+	return UnknownAge
+}
+
+// OrderAgeBands returns every band in age order, bands without users included,
+// followed by UnknownAge when there are users without a valid DOB.
+func OrderAgeBands(counts map[string]int64) []model.Count {
+	out := make([]model.Count, 0, len(AgeBands)+1)
+	for _, band := range AgeBands {
+		out = append(out, model.Count{Label: band.Label, Count: counts[band.Label]})
+	}
+	if n := counts[UnknownAge]; n > 0 {
+		out = append(out, model.Count{Label: UnknownAge, Count: n})
+	}
+	return out
+}
+
+// NotSet labels users that have no value for a field
+const NotSet = "Not set"
+
+// Counts turns a label to count map into counts sorted with SortCounts
+func Counts(byLabel map[string]int64) []model.Count {
+	counts := make([]model.Count, 0, len(byLabel))
+	for label, n := range byLabel {
+		counts = append(counts, model.Count{Label: label, Count: n})
+	}
+	SortCounts(counts)
+	return counts
+}
+
+// SortCounts orders by count, highest first, and by label for equal counts
+func SortCounts(counts []model.Count) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Label < counts[j].Label
+	})
+}
+
+// PeriodStart truncates t in UTC to the start of its day, ISO week (Monday) or month
+func PeriodStart(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case model.IntervalWeek:
+		offset := (int(day.Weekday()) + 6) % 7 // days since Monday
+		return day.AddDate(0, 0, -offset)
+	case model.IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// NextPeriod returns the start of the period after start
+func NextPeriod(start time.Time, interval string) time.Time {
+	switch interval {
+	case model.IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case model.IntervalMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// PeriodCount returns how many periods the filter spans
+func PeriodCount(f model.StatsFilter) int {
+	n := 0
+	for p := PeriodStart(f.From, f.Interval); p.Before(f.To); p = NextPeriod(p, f.Interval) {
+		n++
+	}
+	return n
+}
+
+// FillSeries returns one labelled count per period of the filter, periods without
+// registrations included, so the chart has no gaps.
+func FillSeries(series []model.PeriodCount, f model.StatsFilter) []model.Count {
+	byStart := make(map[time.Time]int64, len(series))
+	for _, p := range series {
+		byStart[p.Start.UTC()] += p.Count
+	}
+
+	layout := "2006-01-02"
+	if f.Interval == model.IntervalMonth {
+		layout = "Jan 2006"
+	}
+
+	var out []model.Count
+	for p := PeriodStart(f.From, f.Interval); p.Before(f.To); p = NextPeriod(p, f.Interval) {
+		out = append(out, model.Count{Label: p.Format(layout), Count: byStart[p]})
+	}
+	return out
+}
@@ -0,0 +1,139 @@
+// Package charts draws simple SVG charts on the server, so the dashboard needs no JavaScript.
+package charts
+
+import (
+	"fmt"
+	"go2/model"
+	"html/template"
+	"strings"
+)
+
+const (
+	barColor    = "#4a90d9"
+	columnColor = "#3c965a"
+	textColor   = "#333333"
+	gridColor   = "#dddddd"
+)
+
+var empty = template.HTML(`<p class="chart-empty">No data for this period.</p>`)
+
+// Bars draws one horizontal bar per count, labels on the left and values on the right
+func Bars(title string, data []model.Count) template.HTML {
+	if len(data) == 0 {
+		return empty
+	}
+
+	const (
+		width      = 640
+		labelWidth = 150
+		valueWidth = 60
+		rowHeight  = 26
+		barHeight  = 18
+	)
+	barArea := float64(width - labelWidth - valueWidth)
+	height := len(data)*rowHeight + 10
+	max := maxCount(data)
+
+	var b strings.Builder
+	svgOpen(&b, title, width, height)
+	for i, c := range data {
+		y := 5 + i*rowHeight
+		w := 0.0
+		if max > 0 {
+			w = barArea * float64(c.Count) / float64(max)
+		}
+		label := template.HTMLEscapeString(c.Label)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" font-size="13" fill="%s">%s</text>`,
+			labelWidth-8, y+barHeight-4, textColor, label)
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="%s"><title>%s: %d</title></rect>`,
+			labelWidth, y, w, barHeight, barColor, label, c.Count)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" font-size="13" fill="%s">%d</text>`,
+			float64(labelWidth)+w+6, y+barHeight-4, textColor, c.Count)
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// Columns draws a time series as vertical columns with a value axis
+func Columns(title string, data []model.Count) template.HTML {
+	if len(data) == 0 {
+		return empty
+	}
+
+	const (
+		width   = 760
+		height  = 280
+		left    = 45
+		right   = 10
+		top     = 10
+		bottom  = 70
+		ticks   = 4
+		maxTags = 12 // at most this many x labels, the others are skipped
+	)
+	plotW := float64(width - left - right)
+	plotH := float64(height - top - bottom)
+	max := niceMax(maxCount(data), ticks)
+
+	var b strings.Builder
+	svgOpen(&b, title, width, height)
+
+	for i := 0; i <= ticks; i++ {
+		value := max * int64(i) / ticks
+		y := float64(top) + plotH - plotH*float64(i)/ticks
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="%s"/>`, left, y, width-right, y, gridColor)
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" font-size="11" fill="%s">%d</text>`, left-6, y+4, textColor, value)
+	}
+
+	step := plotW / float64(len(data))
+	gap := step * 0.2
+	every := (len(data) + maxTags - 1) / maxTags
+	for i, c := range data {
+		h := plotH * float64(c.Count) / float64(max)
+		x := float64(left) + float64(i)*step + gap/2
+		label := template.HTMLEscapeString(c.Label)
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %d</title></rect>`,
+			x, float64(top)+plotH-h, step-gap, h, columnColor, label, c.Count)
+		if i%every == 0 {
+			lx := x + (step-gap)/2
+			ly := float64(top) + plotH + 14
+			fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="end" font-size="11" fill="%s" transform="rotate(-40 %.1f %.1f)">%s</text>`,
+				lx, ly, textColor, lx, ly, label)
+		}
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+func svgOpen(b *strings.Builder, title string, width, height int) {
+	t := template.HTMLEscapeString(title)
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="100%%" style="max-width:%dpx" role="img" aria-label="%s" font-family="Arial, sans-serif"><title>%s</title>`,
+		width, height, width, t, t)
+}
+
+func maxCount(data []model.Count) int64 {
+	var max int64
+	for _, c := range data {
+		if c.Count > max {
+			max = c.Count
+		}
+	}
+	return max
+}
+
+// niceMax rounds the axis maximum up so every tick is a whole number
+func niceMax(max int64, ticks int64) int64 {
+	if max < ticks {
+		return ticks
+	}
+	step := (max + ticks - 1) / ticks
+	magnitude := int64(1)
+	for step/magnitude >= 10 {
+		magnitude *= 10
+	}
+	for _, m := range []int64{1, 2, 5, 10} {
+		if m*magnitude >= step {
+			return m * magnitude * ticks
+		}
+	}
+	return step * ticks
+}
@@ -0,0 +1,88 @@
+// passhash-tune measures password hashing on this machine and suggests the strongest settings
+// that still hash within the target time. Run it on the deployment hardware:
+//
+//	go run ./cmd/passhash-tune -target 250ms -max-memory 65536
+//
+// and copy the printed settings into the environment or the config file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go2/passhash"
+	"log"
+	"runtime"
+	"time"
+)
+
+// samples is how often each setting is hashed, the fastest run counts
+const samples = 3
+
+func main() {
+	target := flag.Duration("target", 250*time.Millisecond, "time one hash may take, every login pays it once")
+	maxMemory := flag.Int("max-memory", 64*1024, "most memory in KiB one Argon2id hash may use, concurrent logins multiply it")
+	threads := flag.Int("threads", min(runtime.NumCPU(), 4), "Argon2id threads")
+	flag.Parse()
+
+	if *threads < 1 || *threads > 255 || *maxMemory < 8**threads {
+		log.Fatal("threads must be between 1 and 255 and max-memory at least 8 KiB per thread")
+	}
+
+	fmt.Printf("Target %s per hash on %d CPUs\n\n", *target, runtime.NumCPU())
+
+	// bcrypt doubles its work with every cost step
+	cost := 4
+	for cost < 31 {
+		d := measure(&passhash.Hasher{Algorithm: passhash.Bcrypt, BcryptCost: cost + 1})
+		if d > *target {
+			break
+		}
+		cost++
+	}
+	bcryptTime := measure(&passhash.Hasher{Algorithm: passhash.Bcrypt, BcryptCost: cost})
+	fmt.Printf("bcrypt:   cost %d takes %s\n", cost, bcryptTime.Round(time.Millisecond))
+
+	// Argon2id: as much memory as allowed first, then more passes while there is time left
+	h := &passhash.Hasher{Algorithm: passhash.Argon2id, Time: 1, Memory: uint32(*maxMemory), Threads: uint8(*threads)}
+	for h.Memory > 8*uint32(*threads) && measure(h) > *target {
+		h.Memory /= 2
+	}
+	for {
+		next := *h
+		next.Time++
+		if measure(&next) > *target {
+			break
+		}
+		h = &next
+	}
+	argonTime := measure(h)
+	fmt.Printf("argon2id: time %d, memory %d KiB, threads %d takes %s\n\n", h.Time, h.Memory, h.Threads, argonTime.Round(time.Millisecond))
+
+	if argonTime > *target {
+		fmt.Println("Even the smallest Argon2id setting misses the target, consider a longer target or bcrypt.")
+	}
+	fmt.Println("Environment:")
+	fmt.Println("  PASSWORD_ALGORITHM=argon2id")
+	fmt.Printf("  PASSWORD_ARGON2_TIME=%d\n  PASSWORD_ARGON2_MEMORY=%d\n  PASSWORD_ARGON2_THREADS=%d\n", h.Time, h.Memory, h.Threads)
+	fmt.Printf("  PASSWORD_BCRYPT_COST=%d\n\n", cost)
+	fmt.Println("Config file:")
+	fmt.Println("  password:")
+	fmt.Println("    algorithm: \"argon2id\"")
+	fmt.Printf("    argon2_time: %d\n    argon2_memory: %d\n    argon2_threads: %d\n", h.Time, h.Memory, h.Threads)
+	fmt.Printf("    bcrypt_cost: %d\n", cost)
+}
+
+// measure returns the fastest of a few hashes with the given settings
+func measure(h *passhash.Hasher) time.Duration {
+	best := time.Duration(-1)
+	for range samples {
+		start := time.Now()
+		if _, err := h.Hash("correct horse battery staple"); err != nil {
+			log.Fatal(err)
+		}
+		if d := time.Since(start); best < 0 || d < best {
+			best = d
+		}
+	}
+	return best
+}
@@ -0,0 +1,57 @@
+// webhook-receiver is a local endpoint for trying out webhooks. It checks the signature
+// of every delivery and prints the event:
+//
+//	go run ./cmd/webhook-receiver -secret whsec_... -addr :9000
+//
+// then register http://localhost:9000/ on the admin webhooks page.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go2/webhooks"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	secret := flag.String("secret", os.Getenv("WEBHOOK_SECRET"), "signing secret shown on the webhooks page")
+	status := flag.Int("status", http.StatusOK, "status code to answer with, use 500 to try the retries")
+	flag.Parse()
+
+	http.HandleFunc("POST /", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "reading body failed", http.StatusBadRequest)
+			return
+		}
+
+		verified := "not checked, no -secret given"
+		if *secret != "" {
+			err := webhooks.Verify(*secret, r.Header.Get(webhooks.TimestampHeader), r.Header.Get(webhooks.SignatureHeader), body, 5*time.Minute)
+			if err != nil {
+				log.Printf("rejected %s: %v", r.Header.Get(webhooks.DeliveryHeader), err)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			verified = "ok"
+		}
+
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, body, "", "  ") != nil {
+			pretty.Write(body)
+		}
+		fmt.Printf("----- %s (delivery %s, signature %s) -----\n%s\n",
+			r.Header.Get(webhooks.EventHeader), r.Header.Get(webhooks.DeliveryHeader), verified, pretty.String())
+		w.WriteHeader(*status)
+	})
+
+	log.Printf("webhook receiver listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -0,0 +1,406 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the whole application configuration. It is loaded once in main and the
+// relevant parts are passed to each package.
+type Config struct {
+	HTTP     HTTPConfig     `yaml:"http" toml:"http"`
+	Mongo    MongoConfig    `yaml:"mongo" toml:"mongo"`
+	Admin    AdminConfig    `yaml:"admin" toml:"admin"`
+	Mail     MailConfig     `yaml:"mail" toml:"mail"`
+	App      AppConfig      `yaml:"app" toml:"app"`
+	Password PasswordConfig `yaml:"password" toml:"password"`
+	Log      LogConfig      `yaml:"log" toml:"log"`
+}
+
+type HTTPConfig struct {
+	Addr            string        `yaml:"addr" toml:"addr"`                         // HTTP_ADDR
+	BaseURL         string        `yaml:"base_url" toml:"base_url"`                 // BASE_URL, used to build links in emails
+	ReadTimeout     time.Duration `yaml:"read_timeout" toml:"read_timeout"`         // HTTP_READ_TIMEOUT
+	WriteTimeout    time.Duration `yaml:"write_timeout" toml:"write_timeout"`       // HTTP_WRITE_TIMEOUT
+	IdleTimeout     time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`         // HTTP_IDLE_TIMEOUT
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"` // SHUTDOWN_TIMEOUT, time to drain requests
+}
+
+type MongoConfig struct {
+	URI             string `yaml:"uri" toml:"uri"`                           // MONGO_URI
+	Database        string `yaml:"database" toml:"database"`                 // MONGO_DB_NAME
+	ConnectAttempts int    `yaml:"connect_attempts" toml:"connect_attempts"` // MONGO_CONNECT_ATTEMPTS
+	ChangeStream    bool   `yaml:"change_stream" toml:"change_stream"`       // MONGO_CHANGE_STREAM, needs a replica set
+}
+
+// AdminConfig is the admin seeded into an empty admins collection
+type AdminConfig struct {
+	Email    string `yaml:"email" toml:"email"`       // ADMIN_EMAIL
+	Password string `yaml:"password" toml:"password"` // ADMIN_PASSWORD
+}
+
+type MailConfig struct {
+	Backend string     `yaml:"backend" toml:"backend"` // MAIL_BACKEND: smtp, file, console or memory
+	From    string     `yaml:"from" toml:"from"`       // MAIL_FROM, defaults to SMTP_EMAIL
+	Dir     string     `yaml:"dir" toml:"dir"`         // MAIL_DIR, output of the file backend
+	SMTP    SMTPConfig `yaml:"smtp" toml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host" toml:"host"`         // SMTP_HOST
+	Port     int    `yaml:"port" toml:"port"`         // SMTP_PORT
+	TLSMode  string `yaml:"tls" toml:"tls"`           // SMTP_TLS: starttls, tls or none
+	Username string `yaml:"username" toml:"username"` // SMTP_USERNAME, defaults to SMTP_EMAIL
+	Password string `yaml:"password" toml:"password"` // SMTP_PASSWORD
+}
+
+type AppConfig struct {
+	UserPageLimit   int    `yaml:"user_page_limit" toml:"user_page_limit"`   // USER_PAGE_LIMIT
+	ResetLink       string `yaml:"reset_link" toml:"reset_link"`             // AUTH_LINK, the raw token is appended
+	UserResetLink   string `yaml:"user_reset_link" toml:"user_reset_link"`   // USER_RESET_LINK, the same for the end-user portal
+	VerifyLink      string `yaml:"verify_link" toml:"verify_link"`           // VERIFY_LINK, email verification, the raw token is appended
+	ReportLink      string `yaml:"report_link" toml:"report_link"`           // REPORT_LINK, download of a report too large to attach, the file ID is appended
+	Maintenance     bool   `yaml:"maintenance" toml:"maintenance"`           // MAINTENANCE_MODE
+	MaintenanceFile string `yaml:"maintenance_file" toml:"maintenance_file"` // MAINTENANCE_FILE, maintenance is on while it exists
+	DevMode         bool   `yaml:"dev_mode" toml:"dev_mode"`                 // DEV_MODE, templates and static files are read from disk and reloaded
+	SecretKey       string `yaml:"secret_key" toml:"secret_key"`             // APP_SECRET_KEY, signs flash cookies
+}
+
+// MaintenanceOn reports whether maintenance mode is switched on, by setting or by file
+func (c AppConfig) MaintenanceOn() bool {
+	if c.Maintenance {
+		return true
+	}
+	if c.MaintenanceFile == "" {
+		return false
+	}
+	_, err := os.Stat(c.MaintenanceFile)
+	return err == nil
+}
+
+// PasswordConfig is the policy for new admin and user passwords
+type PasswordConfig struct {
+	MinLength     int    `yaml:"min_length" toml:"min_length"`         // PASSWORD_MIN_LENGTH
+	RequireUpper  bool   `yaml:"require_upper" toml:"require_upper"`   // PASSWORD_REQUIRE_UPPER
+	RequireLower  bool   `yaml:"require_lower" toml:"require_lower"`   // PASSWORD_REQUIRE_LOWER
+	RequireDigit  bool   `yaml:"require_digit" toml:"require_digit"`   // PASSWORD_REQUIRE_DIGIT
+	RequireSymbol bool   `yaml:"require_symbol" toml:"require_symbol"` // PASSWORD_REQUIRE_SYMBOL
+	History       int    `yaml:"history" toml:"history"`               // PASSWORD_HISTORY, earlier passwords that may not be reused
+	BreachDir     string `yaml:"breach_dir" toml:"breach_dir"`         // PASSWORD_BREACH_DIR, SHA-1 range files of breached passwords
+
+	// Hashing of new passwords, older hashes are upgraded at login. go run ./cmd/passhash-tune
+	// suggests values for the hardware.
+	Algorithm     string `yaml:"algorithm" toml:"algorithm"`           // PASSWORD_ALGORITHM: argon2id or bcrypt
+	BcryptCost    int    `yaml:"bcrypt_cost" toml:"bcrypt_cost"`       // PASSWORD_BCRYPT_COST
+	Argon2Time    int    `yaml:"argon2_time" toml:"argon2_time"`       // PASSWORD_ARGON2_TIME, passes over the memory
+	Argon2Memory  int    `yaml:"argon2_memory" toml:"argon2_memory"`   // PASSWORD_ARGON2_MEMORY, KiB
+	Argon2Threads int    `yaml:"argon2_threads" toml:"argon2_threads"` // PASSWORD_ARGON2_THREADS
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level"`   // LOG_LEVEL: debug, info, warn or error
+	Format string `yaml:"format" toml:"format"` // LOG_FORMAT: text or json
+}
+
+func defaults() Config {
+	return Config{
+		HTTP: HTTPConfig{
+			Addr:            ":8080",
+			BaseURL:         "http://localhost:8080",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 20 * time.Second,
+		},
+		Mongo: MongoConfig{Database: "RegistrationMongo", ConnectAttempts: 5},
+		Mail: MailConfig{
+			Backend: "smtp",
+			Dir:     "mail",
+			SMTP:    SMTPConfig{Host: "smtp.gmail.com", Port: 587, TLSMode: "starttls"},
+		},
+		App: AppConfig{UserPageLimit: 5},
+		Password: PasswordConfig{
+			MinLength:    8,
+			RequireUpper: true,
+			RequireLower: true,
+			RequireDigit: true,
+			History:      5,
+			// OWASP's minimum for Argon2id
+			Algorithm:     "argon2id",
+			BcryptCost:    10,
+			Argon2Time:    2,
+			Argon2Memory:  19 * 1024,
+			Argon2Threads: 1,
+		},
+		Log: LogConfig{Level: "info", Format: "text"},
+	}
+}
+
+// Load builds the config from defaults, the optional file at path (YAML or TOML by extension),
+// the .env file and finally the environment. Later sources win. The result is validated.
+func Load(path string) (Config, error) {
+	cfg := defaults()
+
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	// .env is optional, real environment variables take precedence over it
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return cfg, fmt.Errorf("config: reading .env: %w", err)
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return cfg, err
+	}
+
+	if cfg.App.ResetLink == "" {
+		cfg.App.ResetLink = strings.TrimRight(cfg.HTTP.BaseURL, "/") + "/reset?token="
+	}
+	if cfg.App.UserResetLink == "" {
+		cfg.App.UserResetLink = strings.TrimRight(cfg.HTTP.BaseURL, "/") + "/account/reset?token="
+	}
+	if cfg.App.VerifyLink == "" {
+		cfg.App.VerifyLink = strings.TrimRight(cfg.HTTP.BaseURL, "/") + "/verify?token="
+	}
+	if cfg.App.ReportLink == "" {
+		cfg.App.ReportLink = strings.TrimRight(cfg.HTTP.BaseURL, "/") + "/reports/files/"
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: reading %s: %w", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("config: %s: unsupported file type, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config: parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+func applyEnv(cfg *Config) error {
+	setString(&cfg.HTTP.Addr, "HTTP_ADDR")
+	setString(&cfg.HTTP.BaseURL, "BASE_URL")
+
+	setString(&cfg.Mongo.URI, "MONGO_URI")
+	setString(&cfg.Mongo.Database, "MONGO_DB_NAME")
+
+	setString(&cfg.Admin.Email, "ADMIN_EMAIL")
+	setString(&cfg.Admin.Password, "ADMIN_PASSWORD")
+
+	// SMTP_EMAIL is the older single setting for both sender and login
+	setString(&cfg.Mail.From, "SMTP_EMAIL")
+	setString(&cfg.Mail.SMTP.Username, "SMTP_EMAIL")
+	setString(&cfg.Mail.Backend, "MAIL_BACKEND")
+	setString(&cfg.Mail.From, "MAIL_FROM")
+	setString(&cfg.Mail.Dir, "MAIL_DIR")
+	setString(&cfg.Mail.SMTP.Host, "SMTP_HOST")
+	setString(&cfg.Mail.SMTP.TLSMode, "SMTP_TLS")
+	setString(&cfg.Mail.SMTP.Username, "SMTP_USERNAME")
+	setString(&cfg.Mail.SMTP.Password, "SMTP_PASSWORD")
+
+	setString(&cfg.App.ResetLink, "AUTH_LINK")
+	setString(&cfg.App.UserResetLink, "USER_RESET_LINK")
+	setString(&cfg.App.VerifyLink, "VERIFY_LINK")
+	setString(&cfg.App.ReportLink, "REPORT_LINK")
+	setString(&cfg.App.MaintenanceFile, "MAINTENANCE_FILE")
+	setString(&cfg.App.SecretKey, "APP_SECRET_KEY")
+
+	setString(&cfg.Password.BreachDir, "PASSWORD_BREACH_DIR")
+	setString(&cfg.Password.Algorithm, "PASSWORD_ALGORITHM")
+
+	setString(&cfg.Log.Level, "LOG_LEVEL")
+	setString(&cfg.Log.Format, "LOG_FORMAT")
+
+	var errs []error
+	errs = append(errs, setInt(&cfg.Mail.SMTP.Port, "SMTP_PORT"))
+	errs = append(errs, setInt(&cfg.App.UserPageLimit, "USER_PAGE_LIMIT"))
+	errs = append(errs, setInt(&cfg.Mongo.ConnectAttempts, "MONGO_CONNECT_ATTEMPTS"))
+	errs = append(errs, setBool(&cfg.Mongo.ChangeStream, "MONGO_CHANGE_STREAM"))
+	errs = append(errs, setBool(&cfg.App.Maintenance, "MAINTENANCE_MODE"))
+	errs = append(errs, setBool(&cfg.App.DevMode, "DEV_MODE"))
+	errs = append(errs, setInt(&cfg.Password.MinLength, "PASSWORD_MIN_LENGTH"))
+	errs = append(errs, setBool(&cfg.Password.RequireUpper, "PASSWORD_REQUIRE_UPPER"))
+	errs = append(errs, setBool(&cfg.Password.RequireLower, "PASSWORD_REQUIRE_LOWER"))
+	errs = append(errs, setBool(&cfg.Password.RequireDigit, "PASSWORD_REQUIRE_DIGIT"))
+	errs = append(errs, setBool(&cfg.Password.RequireSymbol, "PASSWORD_REQUIRE_SYMBOL"))
+	errs = append(errs, setInt(&cfg.Password.History, "PASSWORD_HISTORY"))
+	errs = append(errs, setInt(&cfg.Password.BcryptCost, "PASSWORD_BCRYPT_COST"))
+	errs = append(errs, setInt(&cfg.Password.Argon2Time, "PASSWORD_ARGON2_TIME"))
+	errs = append(errs, setInt(&cfg.Password.Argon2Memory, "PASSWORD_ARGON2_MEMORY"))
+	errs = append(errs, setInt(&cfg.Password.Argon2Threads, "PASSWORD_ARGON2_THREADS"))
+	errs = append(errs, setDuration(&cfg.HTTP.ReadTimeout, "HTTP_READ_TIMEOUT"))
+	errs = append(errs, setDuration(&cfg.HTTP.WriteTimeout, "HTTP_WRITE_TIMEOUT"))
+	errs = append(errs, setDuration(&cfg.HTTP.IdleTimeout, "HTTP_IDLE_TIMEOUT"))
+	errs = append(errs, setDuration(&cfg.HTTP.ShutdownTimeout, "SHUTDOWN_TIMEOUT"))
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	if c.HTTP.Addr == "" {
+		errs = append(errs, errors.New("HTTP_ADDR must not be empty"))
+	}
+	if u, err := url.Parse(c.HTTP.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("BASE_URL %q must be an absolute URL", c.HTTP.BaseURL))
+	}
+	if c.HTTP.ReadTimeout <= 0 || c.HTTP.WriteTimeout <= 0 || c.HTTP.IdleTimeout <= 0 || c.HTTP.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("HTTP timeouts must be positive durations such as 15s"))
+	}
+	if c.Mongo.URI == "" {
+		errs = append(errs, errors.New("MONGO_URI is required"))
+	}
+	if c.Mongo.Database == "" {
+		errs = append(errs, errors.New("MONGO_DB_NAME must not be empty"))
+	}
+	if c.Mongo.ConnectAttempts <= 0 {
+		errs = append(errs, fmt.Errorf("MONGO_CONNECT_ATTEMPTS must be positive, got %d", c.Mongo.ConnectAttempts))
+	}
+	if c.App.UserPageLimit <= 0 {
+		errs = append(errs, fmt.Errorf("USER_PAGE_LIMIT must be positive, got %d", c.App.UserPageLimit))
+	}
+	// bcrypt stops at 72 bytes, see passpolicy.MaxLength
+	if c.Password.MinLength < 1 || c.Password.MinLength > 72 {
+		errs = append(errs, fmt.Errorf("PASSWORD_MIN_LENGTH must be between 1 and 72, got %d", c.Password.MinLength))
+	}
+	if c.Password.History < 0 || c.Password.History > 24 {
+		errs = append(errs, fmt.Errorf("PASSWORD_HISTORY must be between 0 and 24, got %d", c.Password.History))
+	}
+	if c.Password.BreachDir != "" {
+		if info, err := os.Stat(c.Password.BreachDir); err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Errorf("PASSWORD_BREACH_DIR %q is not a directory", c.Password.BreachDir))
+		}
+	}
+	switch c.Password.Algorithm {
+	case "bcrypt":
+		if c.Password.BcryptCost < 4 || c.Password.BcryptCost > 31 {
+			errs = append(errs, fmt.Errorf("PASSWORD_BCRYPT_COST must be between 4 and 31, got %d", c.Password.BcryptCost))
+		}
+	case "argon2id":
+		if c.Password.Argon2Time < 1 {
+			errs = append(errs, fmt.Errorf("PASSWORD_ARGON2_TIME must be positive, got %d", c.Password.Argon2Time))
+		}
+		if c.Password.Argon2Threads < 1 || c.Password.Argon2Threads > 255 {
+			errs = append(errs, fmt.Errorf("PASSWORD_ARGON2_THREADS must be between 1 and 255, got %d", c.Password.Argon2Threads))
+		}
+		if c.Password.Argon2Memory < 8*c.Password.Argon2Threads || c.Password.Argon2Memory > 4*1024*1024 {
+			errs = append(errs, fmt.Errorf("PASSWORD_ARGON2_MEMORY must be between 8 KiB per thread and 4 GiB, got %d", c.Password.Argon2Memory))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("PASSWORD_ALGORITHM %q must be argon2id or bcrypt", c.Password.Algorithm))
+	}
+	if c.App.SecretKey != "" && len(c.App.SecretKey) < 32 {
+		errs = append(errs, errors.New("APP_SECRET_KEY must be at least 32 characters"))
+	}
+
+	switch c.Mail.Backend {
+	case "smtp":
+		if c.Mail.SMTP.Host == "" {
+			errs = append(errs, errors.New("SMTP_HOST is required for the smtp mail backend"))
+		}
+		if c.Mail.SMTP.Port <= 0 || c.Mail.SMTP.Port > 65535 {
+			errs = append(errs, fmt.Errorf("SMTP_PORT %d is not a valid port", c.Mail.SMTP.Port))
+		}
+		switch c.Mail.SMTP.TLSMode {
+		case "starttls", "tls", "none":
+		default:
+			errs = append(errs, fmt.Errorf("SMTP_TLS %q must be starttls, tls or none", c.Mail.SMTP.TLSMode))
+		}
+	case "file":
+		if c.Mail.Dir == "" {
+			errs = append(errs, errors.New("MAIL_DIR is required for the file mail backend"))
+		}
+	case "console", "memory":
+	default:
+		errs = append(errs, fmt.Errorf("MAIL_BACKEND %q must be smtp, file, console or memory", c.Mail.Backend))
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("LOG_LEVEL %q must be debug, info, warn or error", c.Log.Level))
+	}
+	switch c.Log.Format {
+	case "text", "json":
+	default:
+		errs = append(errs, fmt.Errorf("LOG_FORMAT %q must be text or json", c.Log.Format))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return nil
+}
+
+func setString(dst *string, key string) {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		*dst = v
+	}
+}
+
+func setInt(dst *int, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s must be a number, got %q", key, v)
+	}
+	*dst = n
+	return nil
+}
+
+func setBool(dst *bool, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("%s must be true or false, got %q", key, v)
+	}
+	*dst = b
+	return nil
+}
+
+func setDuration(dst *time.Duration, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s must be a duration such as 15s, got %q", key, v)
+	}
+	*dst = d
+	return nil
+}
@@ -0,0 +1,72 @@
+// Package csrf protects form posts with the double-submit cookie pattern: a random token is
+// kept in a cookie and every unsafe request must send the same value in a form field or header.
+package csrf
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	CookieName = "csrf_token"
+	FieldName  = "csrf_token"
+	HeaderName = "X-CSRF-Token"
+)
+
+type tokenKey struct{}
+
+// Failure answers requests whose token is missing or wrong, it can be replaced by a branded page
+var Failure http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "Forbidden - invalid CSRF token", http.StatusForbidden)
+})
+
+// Protect makes sure every client has a token cookie and rejects unsafe requests without it
+func Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if c, err := r.Cookie(CookieName); err == nil && len(c.Value) == 43 {
+			token = c.Value
+		} else {
+			token = newToken()
+			http.SetCookie(w, &http.Cookie{
+				Name:     CookieName,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true, // forms get the token from the page, scripts never need the cookie
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		r = r.WithContext(context.WithValue(r.Context(), tokenKey{}, token))
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		default:
+			sent := r.Header.Get(HeaderName)
+			if sent == "" {
+				sent = r.PostFormValue(FieldName)
+			}
+			if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				slog.WarnContext(r.Context(), "CSRF token mismatch", "method", r.Method, "path", r.URL.Path)
+				Failure.ServeHTTP(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Token returns the token of the current request, to be rendered into forms
+func Token(r *http.Request) string {
+	token, _ := r.Context().Value(tokenKey{}).(string)
+	return token
+}
+
+func newToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,190 @@
+package emails
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"go2/mailer"
+)
+
+// Names of the transactional emails, each one has a .html and a .txt template per locale
+const (
+	Reset        = "reset"
+	Invite       = "invite"
+	Verification = "verification"
+	Notification = "notification"
+	Report       = "report"
+)
+
+// DefaultLocale is used when a template does not exist in the requested locale
+const DefaultLocale = "en"
+
+// Names lists every email, used by the admin preview page.
+var Names = []string{Reset, Invite, Verification, Notification, Report}
+
+type ResetData struct {
+	Link string
+}
+
+type InviteData struct {
+	Link      string
+	InvitedBy string
+}
+
+type VerificationData struct {
+	Name string
+	Link string
+}
+
+type NotificationData struct {
+	Heading string
+	Body    string
+	Link    string
+}
+
+// ReportData describes the CSV attached to a scheduled report
+type ReportData struct {
+	Name        string
+	Description string
+	From        string // empty when the report is not about a period
+	To          string
+	Filename    string
+	Rows        int
+	Link        string // download link when the file is too large to attach
+	LinkDays    int    // how long the link works
+}
+
+// funcs are shared by the HTML and text templates
+var funcs = map[string]any{
+	// dict builds a map from key value pairs, used to pass several values to a sub template
+	"dict": func(pairs ...any) (map[string]any, error) {
+		if len(pairs)%2 != 0 {
+			return nil, fmt.Errorf("dict needs an even number of arguments")
+		}
+		m := make(map[string]any, len(pairs)/2)
+		for i := 0; i < len(pairs); i += 2 {
+			key, ok := pairs[i].(string)
+			if !ok {
+				return nil, fmt.Errorf("dict keys must be strings")
+			}
+			m[key] = pairs[i+1]
+		}
+		return m, nil
+	},
+}
+
+// Renderer builds emails from a directory laid out as <locale>/layout.{html,txt} and
+// <locale>/<name>.{html,txt}. Message templates define "subject" and "content" blocks,
+// the layout wraps "content". HTML parts are escaped by html/template, text parts are not.
+type Renderer struct {
+	fsys fs.FS
+}
+
+func NewRenderer(fsys fs.FS) *Renderer {
+	return &Renderer{fsys: fsys}
+}
+
+// Render returns a message with Subject, HTML and Text filled in, the caller sets To.
+func (r *Renderer) Render(name, locale string, data any) (mailer.Message, error) {
+	locale = r.resolveLocale(name, locale)
+
+	html, err := r.renderHTML(name, locale, data)
+	if err != nil {
+		return mailer.Message{}, err
+	}
+
+	textTmpl, err := texttemplate.New("").Funcs(texttemplate.FuncMap(funcs)).ParseFS(r.fsys, path.Join(locale, "layout.txt"), path.Join(locale, name+".txt"))
+	if err != nil {
+		return mailer.Message{}, fmt.Errorf("emails: parsing %s text: %w", name, err)
+	}
+	var text, subject bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&text, "layout", data); err != nil {
+		return mailer.Message{}, fmt.Errorf("emails: executing %s text: %w", name, err)
+	}
+	// The subject comes from the text template, headers must not contain HTML entities
+	if err := textTmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return mailer.Message{}, fmt.Errorf("emails: executing %s subject: %w", name, err)
+	}
+
+	return mailer.Message{
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    html,
+		Text:    text.String(),
+	}, nil
+}
+
+func (r *Renderer) renderHTML(name, locale string, data any) (string, error) {
+	tmpl, err := htmltemplate.New("").Funcs(htmltemplate.FuncMap(funcs)).ParseFS(r.fsys, path.Join(locale, "layout.html"), path.Join(locale, name+".html"))
+	if err != nil {
+		return "", fmt.Errorf("emails: parsing %s html: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "layout", data); err != nil {
+		return "", fmt.Errorf("emails: executing %s html: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// Locales lists the locale directories that exist.
+func (r *Renderer) Locales() []string {
+	entries, err := fs.ReadDir(r.fsys, ".")
+	if err != nil {
+		return []string{DefaultLocale}
+	}
+	var locales []string
+	for _, e := range entries {
+		if e.IsDir() {
+			locales = append(locales, e.Name())
+		}
+	}
+	return locales
+}
+
+// LocaleFromRequest picks the first language from Accept-Language that has templates.
+func (r *Renderer) LocaleFromRequest(req *http.Request) string {
+	available := r.Locales()
+	for _, part := range strings.Split(req.Header.Get("Accept-Language"), ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		lang := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		for _, l := range available {
+			if l == lang {
+				return l
+			}
+		}
+	}
+	return DefaultLocale
+}
+
+func (r *Renderer) resolveLocale(name, locale string) string {
+	if locale == "" {
+		return DefaultLocale
+	}
+	if _, err := fs.Stat(r.fsys, path.Join(locale, name+".html")); err != nil {
+		return DefaultLocale
+	}
+	return locale
+}
+
+// SampleData returns example data for the admin preview page.
+func SampleData(name string) any {
+	switch name {
+	case Reset:
+		return ResetData{Link: "http://localhost:8080/reset?token=example"}
+	case Invite:
+		return InviteData{Link: "http://localhost:8080/invite?token=example", InvitedBy: "admin@example.com"}
+	case Verification:
+		return VerificationData{Name: "Jane", Link: "http://localhost:8080/verify?token=example"}
+	case Report:
+		return ReportData{Name: "Weekly signups", Description: "New users by country", From: "2025-01-06", To: "2025-01-13", Filename: "new-users-by-country-2025-01-13.csv", Rows: 12}
+	case Notification:
+		return NotificationData{Heading: "Your profile was updated", Body: "An administrator changed your profile details.", Link: "http://localhost:8080/"}
+	default:
+		return nil
+	}
+}
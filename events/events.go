@@ -0,0 +1,91 @@
+// Package events is the in-process event bus. It is fed by the MongoDB change stream on
+// users and admins, so changes made outside the app reach the subscribers too.
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Operations of a change
+const (
+	Insert  = "insert"
+	Update  = "update"
+	Replace = "replace"
+	Delete  = "delete"
+)
+
+// Event is one change to a document
+type Event struct {
+	ID         string // unique per change, the same when the change is delivered again after a restart
+	Collection string
+	Operation  string
+	DocumentID primitive.ObjectID
+	Document   bson.Raw // the document after the change, nil for deletes
+	Changed    []string // fields set or removed by an update
+	Time       time.Time
+}
+
+// Handler consumes events. Events are delivered at least once, a handler may see the
+// same event again after a restart and can use Event.ID to notice.
+type Handler func(ctx context.Context, e Event) error
+
+type subscriber struct {
+	name string
+	fn   Handler
+}
+
+// Bus hands every event to the subscribers, one after the other in subscription order.
+type Bus struct {
+	mu   sync.RWMutex
+	subs []subscriber
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe adds a handler, name is used in the logs.
+func (b *Bus) Subscribe(name string, fn Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs = append(b.subs, subscriber{name: name, fn: fn})
+}
+
+// Publish delivers e to every subscriber. A failing subscriber is logged and does not
+// stop the others, a subscriber that must not lose events keeps its own retry queue.
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+
+	for _, s := range subs {
+		if err := call(ctx, s.fn, e); err != nil {
+			slog.ErrorContext(ctx, "event subscriber failed",
+				"subscriber", s.name, "collection", e.Collection, "operation", e.Operation, "document_id", e.DocumentID.Hex(), "error", err)
+		}
+	}
+}
+
+// call runs fn and turns a panic into an error
+func call(ctx context.Context, fn Handler, e Event) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return fn(ctx, e)
+}
+
+// Audit logs every change, field names only so no personal data ends up in the log.
+func Audit(ctx context.Context, e Event) error {
+	slog.InfoContext(ctx, "document changed",
+		"collection", e.Collection, "operation", e.Operation, "document_id", e.DocumentID.Hex(), "fields", e.Changed, "at", e.Time)
+	return nil
+}
@@ -0,0 +1,169 @@
+// Package flash keeps one-time messages across a redirect. They are stored in a cookie signed
+// with HMAC-SHA256, so users cannot forge them, and any text is safe because it is JSON encoded.
+package flash
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type Level string
+
+const (
+	Success Level = "success"
+	Info    Level = "info"
+	Warning Level = "warning"
+	Error   Level = "error"
+)
+
+type Message struct {
+	Level Level  `json:"l"`
+	Text  string `json:"t"`
+}
+
+const cookieName = "flash"
+
+var (
+	keyMu sync.RWMutex
+	key   = randomKey()
+)
+
+// SetKey sets the HMAC key. Without it a random key is used and messages do not survive a
+// restart or reach another instance.
+func SetKey(k []byte) {
+	keyMu.Lock()
+	key = k
+	keyMu.Unlock()
+}
+
+type stateKey struct{}
+
+// state collects the messages of one request
+type state struct {
+	mu       sync.Mutex
+	outgoing []Message
+	incoming []Message
+	popped   bool
+}
+
+// Middleware lets a handler add several messages, without it only the last one is kept
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), stateKey{}, &state{})))
+	})
+}
+
+// Add queues a message for the next page rendered for this client
+func Add(w http.ResponseWriter, r *http.Request, level Level, text string) {
+	st := stateOf(r)
+	st.mu.Lock()
+	st.outgoing = append(st.outgoing, Message{Level: level, Text: text})
+	value := encode(st.outgoing)
+	st.mu.Unlock()
+
+	removeSetCookie(w, cookieName)
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func AddSuccess(w http.ResponseWriter, r *http.Request, text string) { Add(w, r, Success, text) }
+func AddInfo(w http.ResponseWriter, r *http.Request, text string)    { Add(w, r, Info, text) }
+func AddWarning(w http.ResponseWriter, r *http.Request, text string) { Add(w, r, Warning, text) }
+func AddError(w http.ResponseWriter, r *http.Request, text string)   { Add(w, r, Error, text) }
+
+// Pop returns the messages sent by the previous response and deletes the cookie.
+// Calling it again in the same request returns the same messages.
+func Pop(w http.ResponseWriter, r *http.Request) []Message {
+	st := stateOf(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.popped {
+		return st.incoming
+	}
+	st.popped = true
+
+	cookie, err := r.Cookie(cookieName)
+	if err != nil {
+		return nil
+	}
+	st.incoming = decode(cookie.Value)
+
+	// Messages added during this request are still waiting for the next page
+	if len(st.outgoing) == 0 {
+		http.SetCookie(w, &http.Cookie{Name: cookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	}
+	return st.incoming
+}
+
+func stateOf(r *http.Request) *state {
+	if st, ok := r.Context().Value(stateKey{}).(*state); ok {
+		return st
+	}
+	return &state{}
+}
+
+func encode(messages []Message) string {
+	payload, _ := json.Marshal(messages)
+	data := base64.RawURLEncoding.EncodeToString(payload)
+	return data + "." + sign(data)
+}
+
+// decode drops the cookie silently when the signature or the content is wrong
+func decode(value string) []Message {
+	data, sig, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(sign(data))) {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return nil
+	}
+	var messages []Message
+	if err := json.Unmarshal(payload, &messages); err != nil {
+		return nil
+	}
+	return messages
+}
+
+func sign(data string) string {
+	keyMu.RLock()
+	mac := hmac.New(sha256.New, key)
+	keyMu.RUnlock()
+	mac.Write([]byte("flash:" + data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// removeSetCookie drops an earlier Set-Cookie for name, so only the latest value is sent
+func removeSetCookie(w http.ResponseWriter, name string) {
+	header := w.Header()
+	kept := header["Set-Cookie"][:0]
+	for _, line := range header["Set-Cookie"] {
+		if !strings.HasPrefix(line, name+"=") {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) == 0 {
+		header.Del("Set-Cookie")
+		return
+	}
+	header["Set-Cookie"] = kept
+}
+
+func randomKey() []byte {
+	k := make([]byte, 32)
+	_, _ = rand.Read(k)
+	return k
+}
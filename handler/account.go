@@ -0,0 +1,326 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"go2/emails"
+	"go2/flash"
+	"go2/model"
+	"go2/passhash"
+	"go2/render"
+	"go2/repository"
+	"go2/utils"
+	"go2/validator"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The end-user portal lives under /account. It has its own session store and cookie, an admin
+// session never opens it and a user session never opens the admin pages.
+
+type userCtxKey struct{}
+
+// RequireUserLogin protects the portal pages and loads the logged in user into the context
+func (h *Handler) RequireUserLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setNoCacheHeaders(w)
+
+		id, ok := userSessions.get(r)
+		objID, err := primitive.ObjectIDFromHex(id)
+		if !ok || err != nil {
+			http.Redirect(w, r, "/account/login", http.StatusSeeOther)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		user, err := h.repos.Users.FindByID(ctx, objID)
+		cancel()
+		if errors.Is(err, repository.ErrNotFound) {
+			// The account was deleted while logged in
+			userSessions.clearOwner(id)
+			http.Redirect(w, r, "/account/login", http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			render.Error(w, r, http.StatusInternalServerError, "")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userCtxKey{}, user)))
+	})
+}
+
+// currentUser returns the user loaded by RequireUserLogin
+func currentUser(r *http.Request) model.User {
+	user, _ := r.Context().Value(userCtxKey{}).(model.User)
+	return user
+}
+
+func (h *Handler) AccountLoginFormHandler(w http.ResponseWriter, r *http.Request) {
+	setNoCacheHeaders(w)
+
+	if _, ok := userSessions.get(r); ok {
+		http.Redirect(w, r, "/account/", http.StatusSeeOther)
+		return
+	}
+	render.RenderTemplateWithData(w, r, "AccountLogin.html", model.LoginPageData{
+		Title: "Login",
+	})
+}
+
+func (h *Handler) AccountLoginHandler(w http.ResponseWriter, r *http.Request) {
+	setNoCacheHeaders(w)
+
+	email := r.FormValue("email")
+	password := r.FormValue("password")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	user, err := h.repos.Users.FindByEmail(ctx, email)
+	hash := user.Password
+	if err != nil || hash == "" {
+		hash = h.dummyHash
+	}
+	if !passhash.Verify(password, hash) || err != nil || user.Password == "" {
+		slog.WarnContext(ctx, "user login failed", "email", email)
+		render.RenderTemplateWithData(w, r, "AccountLogin.html", model.LoginPageData{
+			Error: "Invalid email or password",
+			Title: "Login",
+		})
+		return
+	}
+
+	slog.InfoContext(ctx, "user login succeeded", "user_id", user.ID.Hex())
+	h.upgradeHash(ctx, password, user.Password, func(ctx context.Context, oldHash, newHash string) error {
+		return h.repos.Users.RehashPassword(ctx, user.ID, oldHash, newHash)
+	})
+	userSessions.set(w, user.ID.Hex())
+	http.Redirect(w, r, "/account/", http.StatusSeeOther)
+}
+
+func (h *Handler) AccountLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	setNoCacheHeaders(w)
+	userSessions.clear(w, r)
+	http.Redirect(w, r, "/account/login", http.StatusSeeOther)
+}
+
+func (h *Handler) AccountForgotFormHandler(w http.ResponseWriter, r *http.Request) {
+	render.RenderTemplateWithData(w, r, "AccountForgot.html", model.ForgotPageData{
+		Title: "Forgot Password",
+	})
+}
+
+func (h *Handler) AccountForgotHandler(w http.ResponseWriter, r *http.Request) {
+	email := r.FormValue("email")
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// The same answer whether or not the account exists
+	flash.AddInfo(w, r, "If the email exists, a reset link will be sent.")
+	user, err := h.repos.Users.FindByEmail(ctx, email)
+	if err != nil {
+		slog.InfoContext(ctx, "user password reset requested for unknown email", "email", email)
+		http.Redirect(w, r, "/account/forgot", http.StatusSeeOther)
+		return
+	}
+
+	rawToken := utils.GenerateSecureToken(64)
+	tokenHash := utils.HashToken(model.TokenPurposeUserReset, rawToken)
+	if err := h.repos.Tokens.Issue(ctx, user.ID, model.TokenPurposeUserReset, tokenHash, time.Now().Add(15*time.Minute)); err != nil {
+		slog.ErrorContext(ctx, "failed to store user reset token", "error", err)
+		http.Redirect(w, r, "/account/forgot", http.StatusSeeOther)
+		return
+	}
+
+	link := h.cfg.UserResetLink + rawToken
+	if err := h.sendEmail(ctx, user.Email, emails.Reset, h.emails.LocaleFromRequest(r), emails.ResetData{Link: link}); err != nil {
+		slog.ErrorContext(ctx, "failed to queue user reset email", "error", err)
+	}
+	http.Redirect(w, r, "/account/forgot", http.StatusSeeOther)
+}
+
+func (h *Handler) AccountResetFormHandler(w http.ResponseWriter, r *http.Request) {
+	setNoCacheHeaders(w)
+
+	rawToken := r.URL.Query().Get("token")
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if _, err := h.repos.Tokens.Find(ctx, model.TokenPurposeUserReset, utils.HashToken(model.TokenPurposeUserReset, rawToken)); err != nil {
+		render.RenderTemplateWithData(w, r, "AccountReset.html", model.ResetPageData{
+			Error: "Invalid or expired token",
+			Title: "Reset Password",
+		})
+		return
+	}
+	render.RenderTemplateWithData(w, r, "AccountReset.html", model.ResetPageData{
+		Token: rawToken,
+		Title: "Reset Password",
+	})
+}
+
+func (h *Handler) AccountResetHandler(w http.ResponseWriter, r *http.Request) {
+	setNoCacheHeaders(w)
+
+	rawToken := r.URL.Query().Get("token")
+	tokenHash := utils.HashToken(model.TokenPurposeUserReset, rawToken)
+	password := r.FormValue("password")
+	if password != r.FormValue("confirm") {
+		render.RenderTemplateWithData(w, r, "AccountReset.html", model.ResetPageData{
+			Error: "Passwords do not match.",
+			Token: rawToken,
+			Title: "Reset Password",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// The policy is checked before the token is used up, so the form can be corrected
+	token, err := h.repos.Tokens.Find(ctx, model.TokenPurposeUserReset, tokenHash)
+	var user model.User
+	if err == nil {
+		user, err = h.repos.Users.FindByID(ctx, token.UserID)
+	}
+	if err != nil {
+		render.RenderTemplateWithData(w, r, "AccountReset.html", model.ResetPageData{
+			Error: "Invalid or expired token",
+			Title: "Reset Password",
+		})
+		return
+	}
+	if problems := h.passwords.Check(password, previousPasswords(user.Password, user.PasswordHistory)...); len(problems) > 0 {
+		render.RenderTemplateWithData(w, r, "AccountReset.html", model.ResetPageData{
+			Error: strings.Join(problems, " "),
+			Token: rawToken,
+			Title: "Reset Password",
+		})
+		return
+	}
+
+	// Consume the token atomically, a second request with the same link finds nothing
+	token, err = h.repos.Tokens.Consume(ctx, model.TokenPurposeUserReset, tokenHash)
+	if err != nil {
+		render.RenderTemplateWithData(w, r, "AccountReset.html", model.ResetPageData{
+			Error: "Invalid or expired token",
+			Title: "Reset Password",
+		})
+		return
+	}
+
+	if err := h.setUserPassword(ctx, token.UserID, password); err != nil {
+		slog.ErrorContext(ctx, "failed to reset user password", "error", err)
+		render.RenderTemplateWithData(w, r, "AccountReset.html", model.ResetPageData{
+			Error: "Failed to update password, request a new reset link.",
+			Title: "Reset Password",
+		})
+		return
+	}
+
+	flash.AddSuccess(w, r, "Password updated, you can log in now.")
+	http.Redirect(w, r, "/account/login", http.StatusSeeOther)
+}
+
+// ProfileHandler shows the logged in user's profile
+func (h *Handler) ProfileHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if len(user.Image) > 0 {
+		user.ImageBase64 = base64.StdEncoding.EncodeToString(user.Image)
+	}
+	if len(user.DOB) > 10 {
+		user.DOB = user.DOB[:10]
+	}
+	render.RenderTemplateWithData(w, r, "Account.html", model.EditPageData{
+		Title: "My Profile",
+		User:  user,
+	})
+}
+
+func (h *Handler) ProfileEditFormHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	countries, _ := h.repos.Countries.List(ctx)
+	renderEditForm(w, r, "AccountEdit.html", currentUser(r), countries, nil)
+}
+
+func (h *Handler) ProfileUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	user, countries, errs, err := h.saveProfile(ctx, r, currentUser(r))
+	if errs.Any() {
+		renderEditForm(w, r, "AccountEdit.html", user, countries, errs)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "profile update failed", "user_id", user.ID.Hex(), "error", err)
+		flash.AddError(w, r, "Your profile could not be saved, please try again.")
+	} else {
+		flash.AddSuccess(w, r, "Profile updated.")
+	}
+	http.Redirect(w, r, "/account/", http.StatusSeeOther)
+}
+
+func (h *Handler) PasswordFormHandler(w http.ResponseWriter, r *http.Request) {
+	render.RenderTemplateWithData(w, r, "AccountPassword.html", model.PasswordPageData{
+		Title: "Change Password",
+	})
+}
+
+func (h *Handler) PasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	password := r.FormValue("password")
+
+	errs := validator.Errors{}
+	if !passhash.Verify(r.FormValue("current"), user.Password) {
+		errs.Add("current", "Current password is not correct")
+	}
+	if problems := h.passwords.Check(password, previousPasswords(user.Password, user.PasswordHistory)...); len(problems) > 0 {
+		errs.Add("password", strings.Join(problems, " "))
+	}
+	validator.ConfirmPassword(errs, password, r.FormValue("confirm"))
+	if errs.Any() {
+		render.RenderTemplateWithStatus(w, r, http.StatusBadRequest, "AccountPassword.html", model.PasswordPageData{
+			Title:  "Change Password",
+			Errors: errs,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.setUserPassword(ctx, user.ID, password); err != nil {
+		slog.ErrorContext(ctx, "password change failed", "user_id", user.ID.Hex(), "error", err)
+		render.RenderTemplateWithData(w, r, "AccountPassword.html", model.PasswordPageData{
+			Title: "Change Password",
+			Error: "Your password could not be changed, please try again.",
+		})
+		return
+	}
+
+	// Every other session ended in setUserPassword, this browser gets a fresh one
+	userSessions.set(w, user.ID.Hex())
+	flash.AddSuccess(w, r, "Password changed.")
+	http.Redirect(w, r, "/account/", http.StatusSeeOther)
+}
+
+// setUserPassword stores a new password and ends every session of the user
+func (h *Handler) setUserPassword(ctx context.Context, id primitive.ObjectID, password string) error {
+	hashed, err := h.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	if err := h.repos.Users.UpdatePassword(ctx, id, hashed, h.passwords.History); err != nil {
+		return err
+	}
+	userSessions.clearOwner(id.Hex())
+	return nil
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"go2/model"
+	"go2/repository"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// apiUser is the JSON view of a user, the password hash and the image bytes are never sent
+type apiUser struct {
+	ID       string   `json:"id"`
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+	Verified bool     `json:"email_verified"`
+	Mobile   string   `json:"mobile"`
+	Address  string   `json:"address"`
+	Gender   string   `json:"gender"`
+	Sports   []string `json:"sports"`
+	DOB      string   `json:"dob"`
+	Country  string   `json:"country"`
+	HasImage bool     `json:"has_image"`
+}
+
+func toAPIUser(user model.User) apiUser {
+	sports := []string{}
+	for _, sport := range strings.Split(user.Sports, ",") {
+		if sport = strings.TrimSpace(sport); sport != "" {
+			sports = append(sports, sport)
+		}
+	}
+	return apiUser{
+		ID:       user.ID.Hex(),
+		Username: user.Username,
+		Email:    user.Email,
+		Verified: user.EmailVerified,
+		Mobile:   user.Mobile,
+		Address:  user.Address,
+		Gender:   user.Gender,
+		Sports:   sports,
+		DOB:      user.DOB,
+		Country:  user.Country,
+		HasImage: len(user.Image) > 0,
+	}
+}
+
+// APIUsersHandler returns one page of users, with the same page, sort and filter parameters as /home
+func (h *Handler) APIUsersHandler(w http.ResponseWriter, r *http.Request) {
+	page := 1
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	sortField := r.URL.Query().Get("field")
+	switch sortField {
+	case "username", "email", "mobile":
+	default:
+		sortField = "_id"
+	}
+	sortOrder := r.URL.Query().Get("order")
+	if sortOrder != "asc" {
+		sortOrder = "desc"
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	users, total, err := h.repos.Users.List(ctx, userFilter(r), page, h.cfg.UserPageLimit, sortField, sortOrder)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list users"})
+		return
+	}
+
+	out := make([]apiUser, 0, len(users))
+	for _, user := range users {
+		out = append(out, toAPIUser(user))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"users":       out,
+		"page":        page,
+		"total":       total,
+		"total_pages": (total + int64(h.cfg.UserPageLimit) - 1) / int64(h.cfg.UserPageLimit),
+	})
+}
+
+func (h *Handler) APIUserHandler(w http.ResponseWriter, r *http.Request) {
+	objID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	user, err := h.repos.Users.FindByID(ctx, objID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "user not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load user"})
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPIUser(user))
+}
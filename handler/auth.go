@@ -1,78 +1,68 @@
 package handler
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"go2/emails"
+	"go2/flash"
+	"go2/metrics"
 	"go2/model"
-	"go2/mongo"
+	"go2/passhash"
 	"go2/render"
 	"go2/utils"
+	"log/slog"
 	"net/http"
-	"os"
-	"text/template"
+	"strings"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
-	"gopkg.in/gomail.v2"
 )
 
-func sendResetEmail(toEmail, resetLink string) error {
-	tmpl, err := template.ParseFiles("templates/reset_email.html")
+// sendEmail renders one of the transactional emails and hands it to the mailer
+func (h *Handler) sendEmail(ctx context.Context, to, name, locale string, data any) error {
+	msg, err := h.emails.Render(name, locale, data)
 	if err != nil {
-		return fmt.Errorf("error parsing template: %w", err)
+		return err
 	}
+	msg.To = []string{to}
 
-	var bodyBuffer bytes.Buffer
-	err = tmpl.Execute(&bodyBuffer, struct{ Link string }{Link: resetLink})
-	if err != nil {
-		return fmt.Errorf("error executing template: %w", err)
-	}
-
-	email := os.Getenv("SMTP_EMAIL")
-	password := os.Getenv("SMTP_PASSWORD")
-
-	m := gomail.NewMessage()
-	m.SetHeader("From", email)
-	m.SetHeader("To", toEmail)
-	m.SetHeader("Subject", "Password Reset Link")
-	m.SetBody("text/html", bodyBuffer.String())
-
-	//Configures SMTP dialer using Gmail
-	d := gomail.NewDialer("smtp.gmail.com", 587, email, password)
-
-	if err := d.DialAndSend(m); err != nil {
+	if err := h.mail.Send(ctx, msg); err != nil {
 		return fmt.Errorf("failed to send mail: %w", err)
 	}
 	return nil
 }
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoginFormHandler(w http.ResponseWriter, r *http.Request) {
 	setNoCacheHeaders(w)
 
-	if r.Method == http.MethodGet {
-		// If already logged in, redirect to home
-		if _, ok := GetSessionEmail(r); ok {
-			http.Redirect(w, r, "/home", http.StatusSeeOther)
-			return
-		}
-		render.RenderTemplateWithData(w, "Login.html", model.LoginPageData{
-			Title: "Login",
-		})
+	// If already logged in, redirect to home
+	if _, ok := GetSessionEmail(r); ok {
+		http.Redirect(w, r, "/home", http.StatusSeeOther)
 		return
 	}
+	render.RenderTemplateWithData(w, r, "Login.html", model.LoginPageData{
+		Title: "Login",
+	})
+}
+
+func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	setNoCacheHeaders(w)
 
-	//POST Logic
 	email := r.FormValue("email")
 	password := r.FormValue("password")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	admin, err := mongo.GetAdminByEmail(ctx, email)
+	// An unknown email is checked against the dummy hash, so it takes as long as a wrong password
+	admin, err := h.repos.Admins.FindByEmail(ctx, email)
+	hash := admin.Password
+	if err != nil || hash == "" {
+		hash = h.dummyHash
+	}
 
-	if err != nil || bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte(password)) != nil {
-		render.RenderTemplateWithData(w, "Login.html", model.LoginPageData{
+	if !passhash.Verify(password, hash) || err != nil || admin.Password == "" {
+		metrics.LoginAttempts.WithLabelValues("failure").Inc()
+		slog.WarnContext(ctx, "login failed", "email", email)
+		render.RenderTemplateWithData(w, r, "Login.html", model.LoginPageData{
 			Error: "Invalid email or password",
 			Title: "Login",
 		})
@@ -80,129 +70,183 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Set session using in-memory map and cookie, Login successful redirect to home
+	metrics.LoginAttempts.WithLabelValues("success").Inc()
+	slog.InfoContext(ctx, "login succeeded", "email", email)
+	h.upgradeHash(ctx, password, admin.Password, func(ctx context.Context, oldHash, newHash string) error {
+		return h.repos.Admins.RehashPassword(ctx, admin.ID, oldHash, newHash)
+	})
+	h.publish(ctx, model.EventAdminLogin, map[string]any{"email": admin.Email, "logged_in_at": time.Now().UTC()})
 	SetSession(w, email)
 	http.Redirect(w, r, "/home", http.StatusSeeOther)
 }
 
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	setNoCacheHeaders(w)
 	ClearSession(w, r)
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
-	// Get request, displays forget password form
-	if r.Method == http.MethodGet {
-		render.RenderTemplateWithData(w, "Forgot.html", model.ForgotPageData{
-			Info:  utils.GetFlashMessage(w, r),
-			Title: "Forgot Password",
-			Error: "",
-		})
-		return
-	}
+// ForgotPasswordFormHandler displays the forgot password form
+func (h *Handler) ForgotPasswordFormHandler(w http.ResponseWriter, r *http.Request) {
+	render.RenderTemplateWithData(w, r, "Forgot.html", model.ForgotPageData{
+		Title: "Forgot Password",
+		Error: "",
+	})
+}
 
+func (h *Handler) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	// Admin enters email through form
 	email := r.FormValue("email")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	admin, err := mongo.GetAdminByEmail(ctx, email)
-	utils.SetFlashMessage(w, "If the email exists, a reset link will be sent.")
+	admin, err := h.repos.Admins.FindByEmail(ctx, email)
+	flash.AddInfo(w, r, "If the email exists, a reset link will be sent.")
 	if err != nil {
-		fmt.Println("Email not found in DB:", email)
+		slog.InfoContext(ctx, "password reset requested for unknown email", "email", email)
 		http.Redirect(w, r, "/forgot", http.StatusSeeOther)
 		return
 	}
 
-	// Generate secure token (generate + hash + expiry)
+	// Generate secure token (generate + hash + expiry), issuing it replaces any older reset link
 	rawToken := utils.GenerateSecureToken(64)
-	tokenHash := utils.HashSHA256(rawToken)
-	expiry := time.Now().Add(15 * time.Minute).Unix()
+	tokenHash := utils.HashToken(model.TokenPurposeAdminReset, rawToken)
+	expiresAt := time.Now().Add(15 * time.Minute)
 
-	// Store in password reset tokens collection
-	err = mongo.InsertResetToken(ctx, admin.ID, tokenHash, expiry)
+	err = h.repos.Tokens.Issue(ctx, admin.ID, model.TokenPurposeAdminReset, tokenHash, expiresAt)
 	if err != nil {
-		fmt.Println("Failed to store token:", err)
+		slog.ErrorContext(ctx, "failed to store reset token", "error", err)
+		http.Redirect(w, r, "/forgot", http.StatusSeeOther)
 		return
 	}
-	fmt.Println("Token stored in DB")
 
-	// Get the base link from environment
-	baseURL := os.Getenv("AUTH_LINK")
-	if baseURL == "" {
-		baseURL = "http://localhost:8080/reset?token="
-	}
-	link := baseURL + rawToken
+	link := h.cfg.ResetLink + rawToken
 
-	// Send reset email
-	err = sendResetEmail(email, link)
+	// Queue reset email, the outbox worker delivers it in the background
+	err = h.sendEmail(ctx, email, emails.Reset, h.emails.LocaleFromRequest(r), emails.ResetData{Link: link})
 	if err != nil {
-		fmt.Println("Failed to send email:", err)
+		slog.ErrorContext(ctx, "failed to queue reset email", "error", err)
 	} else {
-		fmt.Println("Email sent to:", email)
+		metrics.ResetEmailsQueued.Inc()
+		slog.InfoContext(ctx, "reset email queued", "email", email)
 	}
 
 	http.Redirect(w, r, "/forgot", http.StatusSeeOther)
 }
 
-func ResetHandler(w http.ResponseWriter, r *http.Request) {
+// ResetFormHandler shows the new password form for a valid reset link
+func (h *Handler) ResetFormHandler(w http.ResponseWriter, r *http.Request) {
 	setNoCacheHeaders(w)
 
 	rawToken := r.URL.Query().Get("token")
-	tokenHash := utils.HashSHA256(rawToken)
+	tokenHash := utils.HashToken(model.TokenPurposeAdminReset, rawToken)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	tokenData, err := mongo.FindResetToken(ctx, tokenHash)
+	// Expired tokens never match, the TTL index removes them from the collection
+	if _, err := h.repos.Tokens.Find(ctx, model.TokenPurposeAdminReset, tokenHash); err != nil {
+		render.RenderTemplateWithData(w, r, "Reset.html", model.ResetPageData{
+			Error: "Invalid or expired token",
+			Title: "Reset Password",
+		})
+		return
+	}
+
+	render.RenderTemplateWithData(w, r, "Reset.html", model.ResetPageData{
+		Token: rawToken,
+		Title: "Reset Password",
+	})
+}
+
+func (h *Handler) ResetHandler(w http.ResponseWriter, r *http.Request) {
+	setNoCacheHeaders(w)
+
+	rawToken := r.URL.Query().Get("token")
+	tokenHash := utils.HashToken(model.TokenPurposeAdminReset, rawToken)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	newPass := r.FormValue("password")
+	confirm := r.FormValue("confirm")
+	if newPass != confirm {
+		render.RenderTemplateWithData(w, r, "Reset.html", model.ResetPageData{
+			Error: "Passwords do not match.",
+			Token: rawToken,
+			Title: "Reset Password",
+		})
+		return
+	}
+
+	// The policy is checked before the token is used up, so the form can be corrected
+	tokenData, err := h.repos.Tokens.Find(ctx, model.TokenPurposeAdminReset, tokenHash)
+	var admin model.Admin
+	if err == nil {
+		admin, err = h.repos.Admins.FindByID(ctx, tokenData.UserID)
+	}
 	if err != nil {
-		render.RenderTemplateWithData(w, "Reset.html", model.ResetPageData{
+		render.RenderTemplateWithData(w, r, "Reset.html", model.ResetPageData{
 			Error: "Invalid or expired token",
 			Title: "Reset Password",
 		})
 		return
 	}
+	if problems := h.passwords.Check(newPass, previousPasswords(admin.Password, admin.PasswordHistory)...); len(problems) > 0 {
+		render.RenderTemplateWithData(w, r, "Reset.html", model.ResetPageData{
+			Error: strings.Join(problems, " "),
+			Token: rawToken,
+			Title: "Reset Password",
+		})
+		return
+	}
 
-	if time.Now().Unix() > tokenData.TokenExpiry {
-		_ = mongo.DeleteResetTokensByUserID(ctx, tokenData.UserID)
-		render.RenderTemplateWithData(w, "Reset.html", model.ResetPageData{
-			Error: "Token Expired",
+	// Consume the token atomically, a second request with the same link finds nothing
+	tokenData, err = h.repos.Tokens.Consume(ctx, model.TokenPurposeAdminReset, tokenHash)
+	if err != nil {
+		render.RenderTemplateWithData(w, r, "Reset.html", model.ResetPageData{
+			Error: "Invalid or expired token",
 			Title: "Reset Password",
 		})
 		return
 	}
 
-	if r.Method == http.MethodPost {
-		newPass := r.FormValue("password")
-		confirm := r.FormValue("confirm")
-		if newPass != confirm {
-			render.RenderTemplateWithData(w, "Reset.html", model.ResetPageData{
-				Error: "Passwords do not match.",
-				Token: rawToken,
-				Title: "Reset Password",
-			})
-			return
-		}
-
-		hashedPass, _ := bcrypt.GenerateFromPassword([]byte(newPass), bcrypt.DefaultCost)
-		err := mongo.UpdateAdminPassword(ctx, tokenData.UserID, string(hashedPass))
-		if err != nil {
-			render.RenderTemplateWithData(w, "Reset.html", model.ResetPageData{
-				Error: "Failed to update password.",
-				Token: rawToken,
-				Title: "Reset Password",
-			})
-			return
-		}
-
-		_ = mongo.DeleteResetTokensByUserID(ctx, tokenData.UserID)
-		utils.SetFlashMessage(w, "Password updated successfully.")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+	hashedPass, err := h.hasher.Hash(newPass)
+	if err == nil {
+		err = h.repos.Admins.UpdatePassword(ctx, tokenData.UserID, hashedPass, h.passwords.History)
+	}
+	if err != nil {
+		render.RenderTemplateWithData(w, r, "Reset.html", model.ResetPageData{
+			Error: "Failed to update password, request a new reset link.",
+			Title: "Reset Password",
+		})
 		return
 	}
+	// Whoever got hold of the old password is logged out too, without waiting for the change stream
+	ClearSessionsFor(admin.Email)
 
-	render.RenderTemplateWithData(w, "Reset.html", model.ResetPageData{
-		Token: rawToken,
-		Title: "Reset Password",
-	})
+	flash.AddSuccess(w, r, "Password updated successfully.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// previousPasswords lists the current hash and the remembered ones for the reuse check
+func previousPasswords(current string, history []string) []string {
+	return append([]string{current}, history...)
+}
+
+// upgradeHash rehashes a password that just verified when its hash was made with another
+// algorithm or weaker parameters than configured. A failure only postpones it to the next login.
+func (h *Handler) upgradeHash(ctx context.Context, password, oldHash string, save func(ctx context.Context, oldHash, newHash string) error) {
+	if !h.hasher.NeedsRehash(oldHash) {
+		return
+	}
+	newHash, err := h.hasher.Hash(password)
+	if err == nil {
+		err = save(ctx, oldHash, newHash)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "password hash upgrade failed", "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "password hash upgraded", "algorithm", h.hasher.Algorithm)
 }
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"go2/analytics"
+	"go2/charts"
+	"go2/model"
+	"go2/render"
+	"math"
+	"net/http"
+	"time"
+)
+
+// maxPeriods keeps the registration chart readable, e.g. one year per day
+const maxPeriods = 400
+
+// The range becomes an _id range, an ObjectID holds the time as 32 bit unsigned seconds
+var (
+	earliestDate = time.Unix(0, 0).UTC()
+	latestDate   = time.Unix(math.MaxUint32, 0).UTC()
+)
+
+// DashboardHandler shows user demographics and registrations for a date range
+func (h *Handler) DashboardHandler(w http.ResponseWriter, r *http.Request) {
+	setNoCacheHeaders(w)
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	data := model.DashboardPageData{
+		Title:     "Dashboard",
+		From:      today.AddDate(0, 0, -89).Format("2006-01-02"),
+		To:        today.Format("2006-01-02"),
+		Interval:  model.IntervalWeek,
+		Intervals: []string{model.IntervalDay, model.IntervalWeek, model.IntervalMonth},
+	}
+
+	// Get query parameters, the range is inclusive of both days
+	if v := r.URL.Query().Get("from"); v != "" {
+		data.From = v
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		data.To = v
+	}
+	switch v := r.URL.Query().Get("interval"); v {
+	case model.IntervalDay, model.IntervalWeek, model.IntervalMonth:
+		data.Interval = v
+	}
+
+	from, errFrom := time.Parse("2006-01-02", data.From)
+	to, errTo := time.Parse("2006-01-02", data.To)
+	if errFrom != nil || errTo != nil || to.Before(from) {
+		data.Error = "Select a valid date range, the start must not be after the end."
+		render.RenderTemplateWithStatus(w, r, http.StatusBadRequest, "Dashboard.html", data)
+		return
+	}
+
+	filter := model.StatsFilter{From: from, To: to.AddDate(0, 0, 1), Interval: data.Interval}
+	if filter.From.Before(earliestDate) || filter.To.After(latestDate) {
+		data.Error = "Select dates between 1970 and 2105."
+		render.RenderTemplateWithStatus(w, r, http.StatusBadRequest, "Dashboard.html", data)
+		return
+	}
+	if analytics.PeriodCount(filter) > maxPeriods {
+		data.Error = "This range has too many periods, choose a larger interval or a shorter range."
+		render.RenderTemplateWithStatus(w, r, http.StatusBadRequest, "Dashboard.html", data)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	stats, err := h.repos.Analytics.UserStats(ctx, filter)
+	if err != nil {
+		data.Error = "Error loading statistics"
+		render.RenderTemplateWithStatus(w, r, http.StatusInternalServerError, "Dashboard.html", data)
+		return
+	}
+
+	data.Total = stats.Total
+	data.Country = charts.Bars("Users by country", stats.ByCountry)
+	data.Gender = charts.Bars("Users by gender", stats.ByGender)
+	data.Sports = charts.Bars("Users by sport", stats.BySport)
+	data.AgeBands = charts.Bars("Users by age", stats.ByAgeBand)
+	data.Growth = charts.Columns("Registrations per "+data.Interval, analytics.FillSeries(stats.Registrations, filter))
+
+	render.RenderTemplateWithData(w, r, "Dashboard.html", data)
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"go2/emails"
+	"go2/flash"
+	"go2/model"
+	"go2/render"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EmailsHandler lists outbox messages that failed at least once, so admins can resend them
+func (h *Handler) EmailsHandler(w http.ResponseWriter, r *http.Request) {
+	setNoCacheHeaders(w)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	failed, err := h.repos.Outbox.ListFailed(ctx, 100)
+	if err != nil {
+		render.RenderTemplateWithData(w, r, "Emails.html", model.EmailsPageData{
+			Title: "Email Outbox",
+			Error: "Error loading emails",
+		})
+		return
+	}
+
+	render.RenderTemplateWithData(w, r, "Emails.html", model.EmailsPageData{
+		Title:  "Email Outbox",
+		Emails: failed,
+	})
+}
+
+func (h *Handler) ResendEmailHandler(w http.ResponseWriter, r *http.Request) {
+	objID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		flash.AddError(w, r, "Invalid ID")
+		http.Redirect(w, r, "/emails", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.repos.Outbox.Resend(ctx, objID); err != nil {
+		flash.AddError(w, r, "Email could not be queued again")
+	} else {
+		flash.AddSuccess(w, r, "Email queued for delivery")
+	}
+	http.Redirect(w, r, "/emails", http.StatusSeeOther)
+}
+
+// EmailPreviewHandler renders a transactional email with sample data so admins can check both parts
+func (h *Handler) EmailPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	setNoCacheHeaders(w)
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = emails.Reset
+	}
+	locale := r.URL.Query().Get("locale")
+	if locale == "" {
+		locale = emails.DefaultLocale
+	}
+
+	data := model.EmailPreviewPageData{
+		Title:   "Email Preview",
+		Names:   emails.Names,
+		Locales: h.emails.Locales(),
+		Name:    name,
+		Locale:  locale,
+	}
+
+	msg, err := h.emails.Render(name, locale, emails.SampleData(name))
+	if err != nil {
+		data.Error = err.Error()
+	} else {
+		data.Subject = msg.Subject
+		data.HTML = msg.HTML
+		data.Text = msg.Text
+	}
+	render.RenderTemplateWithData(w, r, "EmailPreview.html", data)
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"go2/events"
+	"go2/model"
+	"go2/repository"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// mongo collection names as they appear in change events
+const (
+	usersCollection  = "users"
+	adminsCollection = "admins"
+)
+
+// userEvents maps a change to a users document to the event published for it
+var userEvents = map[string]string{
+	events.Insert:  model.EventUserCreated,
+	events.Update:  model.EventUserUpdated,
+	events.Replace: model.EventUserUpdated,
+	events.Delete:  model.EventUserDeleted,
+}
+
+// WebhookSubscriber turns user changes from the change stream into webhook events. Once it
+// is subscribed the handlers stop publishing them, so changes made outside the app are sent
+// too and nothing is sent twice.
+func (h *Handler) WebhookSubscriber() events.Handler {
+	h.userEventsFromStream.Store(true)
+
+	return func(ctx context.Context, e events.Event) error {
+		if e.Collection != usersCollection {
+			return nil
+		}
+
+		user := model.User{ID: e.DocumentID}
+		if e.Document != nil {
+			if err := bson.Unmarshal(e.Document, &user); err != nil {
+				return err
+			}
+		}
+
+		event, ok := userEvents[e.Operation]
+		if !ok {
+			return nil
+		}
+		return h.events.PublishID(ctx, e.ID, event, toAPIUser(user))
+	}
+}
+
+// LiveSubscriber forwards user changes from the change stream to the open user listings of
+// this instance. Once it is subscribed the handlers stop notifying them directly.
+func (h *Handler) LiveSubscriber() events.Handler {
+	h.liveFromStream.Store(true)
+
+	return func(ctx context.Context, e events.Event) error {
+		if e.Collection != usersCollection {
+			return nil
+		}
+
+		user := model.User{ID: e.DocumentID}
+		if e.Document != nil {
+			if err := bson.Unmarshal(e.Document, &user); err != nil {
+				return err
+			}
+		}
+		event, ok := userEvents[e.Operation]
+		if !ok {
+			return nil
+		}
+		h.live.Publish(liveMessage(event, user, e.Changed))
+		return nil
+	}
+}
+
+// SessionSubscriber ends the sessions of an admin whose password was changed or who was
+// removed, also when that happens directly in the database.
+func (h *Handler) SessionSubscriber() events.Handler {
+	return func(ctx context.Context, e events.Event) error {
+		if e.Collection != adminsCollection {
+			return nil
+		}
+
+		switch e.Operation {
+		case events.Update:
+			if slices.Contains(e.Changed, "password") {
+				if err := clearSessionsOf(e.Document); err != nil {
+					return err
+				}
+			}
+			if slices.Contains(e.Changed, "email") {
+				return h.dropOrphanSessions(ctx)
+			}
+		case events.Replace:
+			// Anything may have changed, the password included
+			if err := clearSessionsOf(e.Document); err != nil {
+				return err
+			}
+			return h.dropOrphanSessions(ctx)
+		case events.Delete:
+			return h.dropOrphanSessions(ctx)
+		}
+		return nil
+	}
+}
+
+// clearSessionsOf ends the sessions of the admin document
+func clearSessionsOf(doc bson.Raw) error {
+	if doc == nil {
+		return nil
+	}
+	var admin model.Admin
+	if err := bson.Unmarshal(doc, &admin); err != nil {
+		return err
+	}
+	ClearSessionsFor(admin.Email)
+	return nil
+}
+
+// dropOrphanSessions ends the sessions whose admin no longer exists. The change event only
+// carries the new document, so the old email is found by checking every session.
+func (h *Handler) dropOrphanSessions(ctx context.Context) error {
+	for _, email := range SessionEmails() {
+		_, err := h.repos.Admins.FindByEmail(ctx, email)
+		if errors.Is(err, repository.ErrNotFound) {
+			ClearSessionsFor(email)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,17 +2,79 @@ package handler
 
 import (
 	"context"
+	"go2/config"
+	"go2/emails"
+	"go2/live"
+	"go2/mailer"
 	"go2/model"
-	"go2/mongo"
+	"go2/passhash"
+	"go2/passpolicy"
 	"go2/render"
-	"go2/utils"
+	"go2/repository"
+	"go2/webhooks"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
-func HomeHandler(w http.ResponseWriter, r *http.Request) {
+// Handler holds the dependencies shared by every HTTP handler. Storage is reached only through
+// the repository interfaces, so the handlers run against MongoDB or the in-memory implementation.
+type Handler struct {
+	repos     repository.Repositories
+	mail      mailer.Mailer
+	emails    *emails.Renderer
+	passwords *passpolicy.Policy
+	hasher    *passhash.Hasher
+	dummyHash string // verified against for unknown accounts, so a failed login takes as long either way
+	cfg       config.AppConfig
+	events    *webhooks.Publisher
+	live      *live.Broker
+	// set once the change stream publishes the user events, the handlers then stop doing it
+	userEventsFromStream atomic.Bool
+	liveFromStream       atomic.Bool
+}
+
+func New(repos repository.Repositories, mail mailer.Mailer, emailTemplates *emails.Renderer, passwords *passpolicy.Policy,
+	hasher *passhash.Hasher, cfg config.AppConfig) *Handler {
+	dummyHash, err := hasher.Hash("not a real password")
+	if err != nil {
+		slog.Error("failed to hash the dummy password", "error", err)
+	}
+	return &Handler{
+		repos:     repos,
+		mail:      mail,
+		emails:    emailTemplates,
+		passwords: passwords,
+		hasher:    hasher,
+		dummyHash: dummyHash,
+		cfg:       cfg,
+		events:    webhooks.NewPublisher(repos.Webhooks, repos.Deliveries),
+		live:      live.NewBroker(),
+	}
+}
+
+// publish queues a webhook event, a failure is logged and never fails the request
+func (h *Handler) publish(ctx context.Context, event string, data any) {
+	if err := h.events.Publish(ctx, event, data); err != nil {
+		slog.ErrorContext(ctx, "failed to queue webhook event", "event", event, "error", err)
+	}
+}
+
+// publishUser queues a user webhook event and notifies the open user listings, unless the
+// change stream already does. fields are the changed fields of an update.
+func (h *Handler) publishUser(ctx context.Context, event string, user model.User, fields ...string) {
+	if !h.userEventsFromStream.Load() {
+		h.publish(ctx, event, toAPIUser(user))
+	}
+	if !h.liveFromStream.Load() {
+		h.live.Publish(liveMessage(event, user, fields))
+	}
+}
+
+func (h *Handler) HomeHandler(w http.ResponseWriter, r *http.Request) {
 	setNoCacheHeaders(w)
 
 	page := 1
@@ -48,28 +110,36 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 		sortOrder = "desc"
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	users, total, err := mongo.GetPaginatedUsers(ctx, page, userPageLimit, sortField, sortOrder)
+	filter := userFilter(r)
+	users, total, err := h.repos.Users.List(ctx, filter, page, h.cfg.UserPageLimit, sortField, sortOrder)
 	if err != nil {
-		render.RenderTemplateWithData(w, "Home.html", model.HomePageData{
+		render.RenderTemplateWithData(w, r, "Home.html", model.HomePageData{
 			Error: "Error counting users",
 		})
 		return
 	}
 
-	totalPages := int((total + int64(userPageLimit) - 1) / int64(userPageLimit))
-	flash := utils.GetFlashMessage(w, r)
-
-	render.RenderTemplateWithData(w, "Home.html", model.HomePageData{
+	totalPages := int((total + int64(h.cfg.UserPageLimit) - 1) / int64(h.cfg.UserPageLimit))
+	render.RenderTemplateWithData(w, r, "Home.html", model.HomePageData{
 		Users:      users,
 		Page:       page,
 		TotalPages: totalPages,
-		Error:      flash,
 		Title:      "User Listing",
 		SortField:  sortField,
 		SortOrder:  sortOrder,
+		Verified:   filter.Verified,
 		AdminName:  adminName,
 	})
 }
+
+// userFilter reads the listing filter from the query, unknown values list everyone
+func userFilter(r *http.Request) model.UserFilter {
+	switch v := r.URL.Query().Get("verified"); v {
+	case model.FilterVerified, model.FilterUnverified:
+		return model.UserFilter{Verified: v}
+	}
+	return model.UserFilter{}
+}
@@ -0,0 +1,991 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"go2/config"
+	"go2/csrf"
+	"go2/emails"
+	"go2/flash"
+	"go2/mailer"
+	"go2/model"
+	"go2/passhash"
+	"go2/passpolicy"
+	"go2/render"
+	"go2/repository"
+	"go2/repository/memory"
+	"go2/router"
+	"go2/templates"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testCSRFToken is put in the cookie jar up front, so every form can send it back
+var testCSRFToken = strings.Repeat("t", 43)
+
+type testApp struct {
+	t      *testing.T
+	srv    *httptest.Server
+	client *http.Client
+	repos  repository.Repositories
+	mail   *mailer.MemoryMailer
+	hasher *passhash.Hasher
+}
+
+// newTestApp serves the handlers with the memory repositories and a memory mailer, on the
+// routes of the app behind its csrf and flash middleware. The client keeps cookies and does
+// not follow redirects.
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+
+	if err := render.Load(templates.Files); err != nil {
+		t.Fatal(err)
+	}
+	emailFS, err := fs.Sub(templates.Files, "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pw := config.PasswordConfig{MinLength: 8, History: 3, Algorithm: passhash.Bcrypt, BcryptCost: bcrypt.MinCost}
+	app := &testApp{
+		t:      t,
+		repos:  memory.New("INDIA", "FRANCE"),
+		mail:   mailer.NewMemoryMailer(),
+		hasher: passhash.New(pw),
+	}
+	cfg := config.AppConfig{
+		UserPageLimit: 10,
+		ResetLink:     "http://example.com/reset?token=",
+		UserResetLink: "http://example.com/account/reset?token=",
+		VerifyLink:    "http://example.com/verify?token=",
+	}
+	h := New(app.repos, mailer.WithDefaultFrom(app.mail, "noreply@example.com"), emails.NewRenderer(emailFS),
+		passpolicy.New(pw), app.hasher, cfg)
+
+	r := router.New()
+	r.Use(csrf.Protect, flash.Middleware)
+	r.NotFound(errorPage(http.StatusNotFound))
+	r.MethodNotAllowed(errorPage(http.StatusMethodNotAllowed))
+	public := r.Group("")
+	public.Get("/{$}", h.LoginFormHandler)
+	public.Post("/{$}", h.LoginHandler)
+	public.Get("/forgot", h.ForgotPasswordFormHandler)
+	public.Post("/forgot", h.ForgotPasswordHandler)
+	public.Get("/reset", h.ResetFormHandler)
+	public.Post("/reset", h.ResetHandler)
+	public.Post("/logout", h.LogoutHandler)
+	public.Get("/verify", h.VerifyEmailHandler)
+	admin := r.Group("", RequireLogin)
+	admin.Get("/home", h.HomeHandler)
+	admin.Get("/dashboard", h.DashboardHandler)
+	admin.Get("/events/users", h.UserEventsHandler)
+	admin.Get("/users/new", h.RegisterFormHandler)
+	admin.Post("/users", h.RegisterHandler)
+	admin.Get("/users/{id}/edit", h.EditHandler)
+	admin.Post("/users/{id}", h.UpdateHandler)
+	admin.Post("/users/{id}/delete", h.DeleteHandler)
+	admin.Post("/users/{id}/verification", h.ResendVerificationHandler)
+	admin.Get("/reports", h.ReportsHandler)
+	admin.Post("/reports", h.CreateReportHandler)
+	admin.Post("/reports/{id}/delete", h.DeleteReportHandler)
+	admin.Post("/reports/{id}/run", h.RunReportHandler)
+	admin.Get("/webhooks", h.WebhooksHandler)
+	admin.Post("/webhooks", h.CreateWebhookHandler)
+	admin.Post("/webhooks/{id}/delete", h.DeleteWebhookHandler)
+	admin.Post("/webhooks/deliveries/{id}/redeliver", h.RedeliverHandler)
+	admin.Get("/emails", h.EmailsHandler)
+	admin.Post("/emails/{id}/resend", h.ResendEmailHandler)
+	admin.Get("/emails/preview", h.EmailPreviewHandler)
+	account := r.Group("/account")
+	account.Get("/login", h.AccountLoginFormHandler)
+	account.Post("/login", h.AccountLoginHandler)
+	account.Get("/forgot", h.AccountForgotFormHandler)
+	account.Post("/forgot", h.AccountForgotHandler)
+	account.Get("/reset", h.AccountResetFormHandler)
+	account.Post("/reset", h.AccountResetHandler)
+	account.Post("/logout", h.AccountLogoutHandler)
+	me := r.Group("/account", h.RequireUserLogin)
+	me.Get("/{$}", h.ProfileHandler)
+	me.Get("/profile", h.ProfileEditFormHandler)
+	me.Post("/profile", h.ProfileUpdateHandler)
+	me.Get("/password", h.PasswordFormHandler)
+	me.Post("/password", h.PasswordHandler)
+	api := r.Group("/api", RequireAPILogin)
+	api.Get("/users", h.APIUsersHandler)
+	api.Get("/users/{id}", h.APIUserHandler)
+
+	app.srv = httptest.NewServer(r)
+	t.Cleanup(app.srv.Close)
+
+	jar, _ := cookiejar.New(nil)
+	u, _ := url.Parse(app.srv.URL)
+	jar.SetCookies(u, []*http.Cookie{{Name: csrf.CookieName, Value: testCSRFToken, Path: "/"}})
+	app.client = &http.Client{
+		Jar:           jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return app
+}
+
+func errorPage(status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		render.Error(w, r, status, "")
+	})
+}
+
+func (a *testApp) hash(password string) string {
+	a.t.Helper()
+	hashed, err := a.hasher.Hash(password)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return hashed
+}
+
+func (a *testApp) addAdmin(email, password string) model.Admin {
+	return a.repos.Admins.(*memory.AdminRepository).Add(model.Admin{Email: email, Password: a.hash(password)})
+}
+
+func (a *testApp) addUser(email, mobile string) model.User {
+	a.t.Helper()
+	user := model.User{
+		ID: primitive.NewObjectID(), Username: "Jane", Email: email, Password: a.hash("correct horse"), Mobile: mobile,
+		Address: "1 Main Street", Gender: "female", Sports: "cricket", DOB: "1990-01-01", Country: "INDIA",
+	}
+	if err := a.repos.Users.Insert(context.Background(), user); err != nil {
+		a.t.Fatal(err)
+	}
+	return user
+}
+
+func (a *testApp) findUser(id primitive.ObjectID) (model.User, error) {
+	return a.repos.Users.FindByID(context.Background(), id)
+}
+
+// users returns every stored user, oldest first
+func (a *testApp) users() []model.User {
+	a.t.Helper()
+	users, _, err := a.repos.Users.List(context.Background(), model.UserFilter{}, 1, 100, "_id", "asc")
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return users
+}
+
+// login starts an admin session in the client's cookie jar
+func (a *testApp) login() {
+	a.t.Helper()
+	a.addAdmin("admin@example.com", "correct horse")
+	resp, _ := a.post("/", url.Values{"email": {"admin@example.com"}, "password": {"correct horse"}})
+	expectRedirect(a.t, resp, "/home")
+}
+
+func (a *testApp) get(path string) (*http.Response, string) {
+	a.t.Helper()
+	resp, err := a.client.Get(a.srv.URL + path)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return resp, readBody(a.t, resp)
+}
+
+// getJSON is get for an API client, errors come back as JSON instead of a page
+func (a *testApp) getJSON(path string) (*http.Response, string) {
+	a.t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, a.srv.URL+path, nil)
+	req.Header.Set("Accept", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return resp, readBody(a.t, resp)
+}
+
+// post submits a form with the csrf token
+func (a *testApp) post(path string, form url.Values) (*http.Response, string) {
+	a.t.Helper()
+	form.Set(csrf.FieldName, testCSRFToken)
+	resp, err := a.client.PostForm(a.srv.URL+path, form)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return resp, readBody(a.t, resp)
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func expectRedirect(t *testing.T, resp *http.Response, location string) {
+	t.Helper()
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != location {
+		t.Fatalf("got %d to %q, want %d to %q", resp.StatusCode, resp.Header.Get("Location"), http.StatusSeeOther, location)
+	}
+}
+
+// expectPage checks that the handler answered with a page containing want
+func expectPage(t *testing.T, resp *http.Response, body, want string) {
+	t.Helper()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %d to %q, want a page", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if !strings.Contains(body, want) {
+		t.Errorf("page does not contain %q", want)
+	}
+}
+
+// expectFlash follows the redirect of resp and checks that the page shows the flash message
+func (a *testApp) expectFlash(resp *http.Response, message string) {
+	a.t.Helper()
+	resp, body := a.get(resp.Header.Get("Location"))
+	expectPage(a.t, resp, body, message)
+}
+
+var tokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// lastToken returns the token of the link in the newest mail to "to"
+func (a *testApp) lastToken(to string) string {
+	a.t.Helper()
+	messages := a.mail.Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if len(messages[i].To) == 1 && messages[i].To[0] == to {
+			if m := tokenPattern.FindStringSubmatch(messages[i].Text); m != nil {
+				return m[1]
+			}
+		}
+	}
+	a.t.Fatalf("no mail with a token sent to %s", to)
+	return ""
+}
+
+func userForm(email, mobile string) url.Values {
+	form := url.Values{
+		"username": {"Jane"},
+		"email":    {email},
+		"password": {"correct horse"},
+		"confirm":  {"correct horse"},
+		"mobile":   {mobile},
+		"address":  {"1 Main Street"},
+		"gender":   {"female"},
+		"sports":   {"cricket", "swimming"},
+		"dob":      {"1990-01-01"},
+		"country":  {"INDIA"},
+	}
+	return form
+}
+
+func TestLogin(t *testing.T) {
+	app := newTestApp(t)
+	app.addAdmin("admin@example.com", "correct horse")
+
+	resp, body := app.get("/")
+	expectPage(t, resp, body, `name="password"`)
+
+	for _, form := range []url.Values{
+		{"email": {"admin@example.com"}, "password": {"wrong password"}},
+		{"email": {"nobody@example.com"}, "password": {"correct horse"}},
+	} {
+		resp, body := app.post("/", form)
+		expectPage(t, resp, body, "Invalid email or password")
+	}
+	resp, _ = app.get("/home")
+	expectRedirect(t, resp, "/")
+
+	resp, _ = app.post("/", url.Values{"email": {"admin@example.com"}, "password": {"correct horse"}})
+	expectRedirect(t, resp, "/home")
+	resp, _ = app.get("/")
+	expectRedirect(t, resp, "/home")
+	resp, body = app.get("/home")
+	expectPage(t, resp, body, "Registered Users")
+}
+
+func TestRehashOnLogin(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+
+	// Hashes made with another algorithm are replaced by the configured one after a login
+	old := passhash.Hasher{Algorithm: passhash.Argon2id, Time: 1, Memory: 64, Threads: 1}
+	oldHash, err := old.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := app.repos.Admins.(*memory.AdminRepository).Add(model.Admin{Email: "admin@example.com", Password: oldHash})
+	user := app.addUser("jane@example.com", "9876543210")
+	if err := app.repos.Users.UpdatePassword(ctx, user.ID, oldHash, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := app.post("/", url.Values{"email": {"admin@example.com"}, "password": {"correct horse"}})
+	expectRedirect(t, resp, "/home")
+	app.userLogin("jane@example.com", "correct horse")
+
+	stored, _ := app.repos.Admins.FindByID(ctx, admin.ID)
+	storedUser, _ := app.findUser(user.ID)
+	for _, hash := range []string{stored.Password, storedUser.Password} {
+		if app.hasher.NeedsRehash(hash) || !passhash.Verify("correct horse", hash) {
+			t.Errorf("hash %q not upgraded", hash)
+		}
+	}
+}
+
+func TestLogout(t *testing.T) {
+	app := newTestApp(t)
+	app.login()
+
+	resp, _ := app.post("/logout", url.Values{})
+	expectRedirect(t, resp, "/")
+	resp, _ = app.get("/home")
+	expectRedirect(t, resp, "/")
+}
+
+func TestAdminPagesNeedLogin(t *testing.T) {
+	app := newTestApp(t)
+	id := primitive.NewObjectID().Hex()
+	for _, path := range []string{"/home", "/dashboard", "/events/users", "/users/new", "/users/" + id + "/edit", "/reports", "/webhooks", "/emails", "/emails/preview"} {
+		resp, _ := app.get(path)
+		expectRedirect(t, resp, "/")
+	}
+	for _, path := range []string{"/users", "/users/" + id, "/users/" + id + "/delete", "/users/" + id + "/verification", "/reports", "/reports/" + id + "/run", "/webhooks", "/emails/" + id + "/resend"} {
+		resp, _ := app.post(path, url.Values{})
+		expectRedirect(t, resp, "/")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	app := newTestApp(t)
+	app.login()
+
+	resp, body := app.get("/users/new")
+	expectPage(t, resp, body, "Add New User")
+
+	resp, _ = app.post("/users", userForm("jane@example.com", "9876543210"))
+	expectRedirect(t, resp, "/home")
+	users := app.users()
+	if len(users) != 1 {
+		t.Fatalf("%d users stored, want 1", len(users))
+	}
+	if user := users[0]; user.Email != "jane@example.com" || user.Sports != "cricket,swimming" || !passhash.Verify("correct horse", user.Password) {
+		t.Errorf("stored user %+v", user)
+	}
+	resp, body = app.get("/home")
+	expectPage(t, resp, body, "jane@example.com")
+
+	invalid := userForm("joe@example.com", "123")
+	invalid.Set("password", "short")
+	invalid.Set("confirm", "something else")
+	resp, body = app.post("/users", invalid)
+	expectPage(t, resp, body, "Invalid mobile number format")
+	expectPage(t, resp, body, "Passwords do not match")
+	expectPage(t, resp, body, "Password must be at least 8 characters long.")
+	resp, body = app.post("/users", userForm("jane@example.com", "9876543211"))
+	expectPage(t, resp, body, "Email already used")
+
+	if users := app.users(); len(users) != 1 {
+		t.Errorf("%d users stored, want 1", len(users))
+	}
+}
+
+func TestEdit(t *testing.T) {
+	app := newTestApp(t)
+	app.login()
+	user := app.addUser("jane@example.com", "9876543210")
+
+	resp, body := app.get("/users/" + user.ID.Hex() + "/edit")
+	expectPage(t, resp, body, `value="jane@example.com"`)
+	for _, id := range []string{"bad", primitive.NewObjectID().Hex()} {
+		resp, body := app.get("/users/" + id + "/edit")
+		if resp.StatusCode != http.StatusNotFound || !strings.Contains(body, "There is no user with this ID.") {
+			t.Errorf("%s: got %d, want the %d page", id, resp.StatusCode, http.StatusNotFound)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	app := newTestApp(t)
+	app.login()
+	user := app.addUser("jane@example.com", "9876543210")
+	app.addUser("joe@example.com", "9876543211")
+
+	path := "/users/" + user.ID.Hex()
+	form := userForm("jane@example.com", "9876543212")
+	form.Set("username", "Jane Doe")
+	resp, _ := app.post(path, form)
+	expectRedirect(t, resp, "/home")
+	app.expectFlash(resp, "User successfully updated!")
+	stored, _ := app.findUser(user.ID)
+	if stored.Username != "Jane Doe" || stored.Mobile != "9876543212" || stored.Email != "jane@example.com" {
+		t.Errorf("stored user %+v", stored)
+	}
+	if len(app.mail.Messages()) != 0 {
+		t.Error("verification mail sent for an unchanged email")
+	}
+
+	// Invalid values and a mobile number of another user show the form again
+	for mobile, message := range map[string]string{
+		"123":        "Invalid mobile number format",
+		"9876543211": "Mobile number already registered",
+	} {
+		resp, body := app.post(path, userForm("jane@example.com", mobile))
+		expectPage(t, resp, body, message)
+	}
+	if stored, _ := app.findUser(user.ID); stored.Mobile != "9876543212" {
+		t.Errorf("mobile changed to %s", stored.Mobile)
+	}
+
+	resp, _ = app.post("/users/bad", userForm("jane@example.com", "9876543213"))
+	expectRedirect(t, resp, "/home")
+	resp, _ = app.post("/users/"+primitive.NewObjectID().Hex(), userForm("jane@example.com", "9876543213"))
+	expectRedirect(t, resp, "/home")
+	app.expectFlash(resp, "User not found")
+}
+
+func TestVerification(t *testing.T) {
+	app := newTestApp(t)
+	app.login()
+
+	resp, _ := app.post("/users", userForm("jane@example.com", "9876543210"))
+	expectRedirect(t, resp, "/home")
+	user := app.users()[0]
+	first := app.lastToken("jane@example.com")
+
+	// A new link replaces the first one
+	resend := "/users/" + user.ID.Hex() + "/verification"
+	resp, _ = app.post(resend, url.Values{})
+	app.expectFlash(resp, "Verification email sent to jane@example.com.")
+	token := app.lastToken("jane@example.com")
+
+	for _, invalid := range []string{first, "bad"} {
+		resp, _ = app.get("/verify?token=" + invalid)
+		expectRedirect(t, resp, "/account/login")
+		app.expectFlash(resp, "This verification link is invalid or has expired.")
+	}
+	if _, body := app.get("/api/users?verified=unverified"); !strings.Contains(body, "jane@example.com") {
+		t.Errorf("unverified users: %s", body)
+	}
+
+	resp, _ = app.get("/verify?token=" + token)
+	expectRedirect(t, resp, "/account/login")
+	app.expectFlash(resp, "Your email address is verified.")
+	if stored, _ := app.findUser(user.ID); !stored.EmailVerified {
+		t.Error("email not marked verified")
+	}
+	resp, _ = app.post(resend, url.Values{})
+	app.expectFlash(resp, "jane@example.com is already verified.")
+
+	// A changed email has to be verified again
+	resp, _ = app.post("/users/"+user.ID.Hex(), userForm("jane.doe@example.com", "9876543210"))
+	expectRedirect(t, resp, "/home")
+	if stored, _ := app.findUser(user.ID); stored.Email != "jane.doe@example.com" || stored.EmailVerified {
+		t.Errorf("stored user %+v", stored)
+	}
+	app.lastToken("jane.doe@example.com")
+	if _, body := app.get("/api/users?verified=verified"); strings.Contains(body, "jane") {
+		t.Errorf("verified users: %s", body)
+	}
+}
+
+func TestUserEvents(t *testing.T) {
+	app := newTestApp(t)
+	app.login()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, app.srv.URL+"/events/users", nil)
+	resp, err := app.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("content type %q", resp.Header.Get("Content-Type"))
+	}
+	stream := bufio.NewReader(resp.Body)
+	if line, _ := stream.ReadString('\n'); line != "retry: 3000\n" {
+		t.Fatalf("first line %q", line)
+	}
+
+	resp, _ = app.post("/users", userForm("jane@example.com", "9876543210"))
+	expectRedirect(t, resp, "/home")
+
+	var event []string
+	for len(event) < 2 {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			event = append(event, line)
+		}
+	}
+	if event[0] != "event: "+model.EventUserCreated || !strings.Contains(event[1], `"email":"jane@example.com"`) {
+		t.Errorf("got event %q", event)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	app := newTestApp(t)
+	app.login()
+	user := app.addUser("jane@example.com", "9876543210")
+
+	path := "/users/" + user.ID.Hex() + "/delete"
+
+	resp, _ := app.getJSON(path)
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+	if _, err := app.findUser(user.ID); err != nil {
+		t.Fatal("GET deleted the user")
+	}
+
+	resp, _ = app.post(path, url.Values{})
+	expectRedirect(t, resp, "/home")
+	if _, err := app.findUser(user.ID); err != repository.ErrNotFound {
+		t.Errorf("user still there, %v", err)
+	}
+	resp, _ = app.post(path, url.Values{})
+	app.expectFlash(resp, "Error deleting user")
+}
+
+func TestDashboard(t *testing.T) {
+	app := newTestApp(t)
+	app.login()
+	app.addUser("jane@example.com", "9876543210")
+	app.addUser("joe@example.com", "9876543211")
+
+	resp, body := app.get("/dashboard")
+	expectPage(t, resp, body, "Users registered in this period: <strong>2</strong>")
+	expectPage(t, resp, body, "Users by country")
+	expectPage(t, resp, body, "INDIA")
+
+	for query, message := range map[string]string{
+		"?from=2024-02-01&to=2024-01-01":              "Select a valid date range",
+		"?from=yesterday":                             "Select a valid date range",
+		"?from=2020-01-01&to=2024-01-01&interval=day": "This range has too many periods",
+		"?from=1969-12-01&to=1970-01-31":              "Select dates between 1970 and 2105.",
+		"?from=2106-03-01&to=2106-03-31":              "Select dates between 1970 and 2105.",
+	} {
+		resp, body := app.get("/dashboard" + query)
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, message) {
+			t.Errorf("%s: got %d, want %d with %q", query, resp.StatusCode, http.StatusBadRequest, message)
+		}
+	}
+}
+
+func TestReports(t *testing.T) {
+	app := newTestApp(t)
+	app.login()
+	ctx := context.Background()
+
+	resp, body := app.get("/reports")
+	expectPage(t, resp, body, `name="recipients"`)
+
+	form := url.Values{
+		"name":       {"Weekly signups"},
+		"kind":       {model.ReportNewUsersByCountry},
+		"frequency":  {model.FrequencyWeekly},
+		"weekday":    {"1"},
+		"hour":       {"6"},
+		"recipients": {"ops@example.com; sales@example.com, ops@example.com"},
+	}
+	invalid := url.Values{"frequency": {model.FrequencyWeekly}, "weekday": {"9"}, "hour": {"24"}, "recipients": {"not-an-address"}}
+	resp, body = app.post("/reports", invalid)
+	for _, message := range []string{"Name is required", "Select a report", "Select a day of the week", "Hour must be between 0 and 23", "Invalid email address: not-an-address"} {
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, message) {
+			t.Errorf("invalid report: got %d, want %d with %q", resp.StatusCode, http.StatusBadRequest, message)
+		}
+	}
+
+	resp, _ = app.post("/reports", form)
+	expectRedirect(t, resp, "/reports")
+	app.expectFlash(resp, "Report scheduled")
+	schedules, _ := app.repos.Reports.List(ctx)
+	if len(schedules) != 1 {
+		t.Fatalf("%d reports stored, want 1", len(schedules))
+	}
+	schedule := schedules[0]
+	if schedule.CreatedBy != "admin@example.com" || len(schedule.Recipients) != 2 || !schedule.NextRunAt.After(time.Now()) {
+		t.Errorf("stored report %+v", schedule)
+	}
+
+	resp, _ = app.post("/reports/"+schedule.ID.Hex()+"/run", url.Values{})
+	app.expectFlash(resp, "Report will be sent within a minute")
+	if schedules, _ := app.repos.Reports.List(ctx); schedules[0].NextRunAt.After(time.Now()) {
+		t.Errorf("run now left the next run at %s", schedules[0].NextRunAt)
+	}
+
+	resp, _ = app.post("/reports/bad/delete", url.Values{})
+	app.expectFlash(resp, "Invalid ID")
+	resp, _ = app.post("/reports/"+schedule.ID.Hex()+"/delete", url.Values{})
+	app.expectFlash(resp, "Report deleted")
+	if schedules, _ := app.repos.Reports.List(ctx); len(schedules) != 0 {
+		t.Errorf("%d reports left", len(schedules))
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	app := newTestApp(t)
+	app.login()
+	ctx := context.Background()
+
+	resp, body := app.post("/webhooks", url.Values{"url": {"ftp://example.com"}, "events": {"user.renamed"}})
+	for _, message := range []string{"Enter an http or https URL", "Unknown event: user.renamed"} {
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, message) {
+			t.Errorf("invalid webhook: got %d, want %d with %q", resp.StatusCode, http.StatusBadRequest, message)
+		}
+	}
+
+	resp, _ = app.post("/webhooks", url.Values{"url": {"https://hooks.example.com/users"}, "events": {model.EventUserCreated}})
+	expectRedirect(t, resp, "/webhooks")
+	app.expectFlash(resp, "Webhook added")
+	hooks, _ := app.repos.Webhooks.List(ctx)
+	if len(hooks) != 1 || hooks[0].Secret == "" || hooks[0].CreatedBy != "admin@example.com" {
+		t.Fatalf("stored webhooks %+v", hooks)
+	}
+	hook := hooks[0]
+
+	// Registering a user queues a delivery for the endpoint
+	resp, _ = app.post("/users", userForm("jane@example.com", "9876543210"))
+	expectRedirect(t, resp, "/home")
+	deliveries, _ := app.repos.Deliveries.List(ctx, hook.ID, 10)
+	if len(deliveries) != 1 || deliveries[0].Event != model.EventUserCreated || !strings.Contains(deliveries[0].Payload, "jane@example.com") {
+		t.Fatalf("deliveries %+v", deliveries)
+	}
+	delivery := deliveries[0]
+
+	resp, body = app.get("/webhooks")
+	expectPage(t, resp, body, "https://hooks.example.com/users")
+
+	redeliver := "/webhooks/deliveries/" + delivery.ID.Hex() + "/redeliver"
+	resp, _ = app.post(redeliver, url.Values{})
+	app.expectFlash(resp, "Delivery could not be queued again")
+	if err := app.repos.Deliveries.MarkFailed(ctx, delivery.ID, model.DeliveryDead, 8, 500, time.Time{}, "server error"); err != nil {
+		t.Fatal(err)
+	}
+	resp, _ = app.post(redeliver, url.Values{})
+	app.expectFlash(resp, "Delivery queued again")
+	if deliveries, _ := app.repos.Deliveries.List(ctx, hook.ID, 10); deliveries[0].Status != model.DeliveryPending || deliveries[0].Attempts != 0 {
+		t.Errorf("redelivered %+v", deliveries[0])
+	}
+
+	resp, _ = app.post("/webhooks/"+hook.ID.Hex()+"/delete", url.Values{})
+	app.expectFlash(resp, "Webhook deleted")
+	if hooks, _ := app.repos.Webhooks.List(ctx); len(hooks) != 0 {
+		t.Errorf("%d webhooks left", len(hooks))
+	}
+}
+
+func TestAdminPasswordReset(t *testing.T) {
+	app := newTestApp(t)
+	app.login()
+
+	resp, body := app.get("/forgot")
+	expectPage(t, resp, body, `name="email"`)
+	resp, _ = app.post("/forgot", url.Values{"email": {"admin@example.com"}})
+	expectRedirect(t, resp, "/forgot")
+	token := app.lastToken("admin@example.com")
+
+	// An unknown email gets the same answer and no mail
+	sent := len(app.mail.Messages())
+	resp, _ = app.post("/forgot", url.Values{"email": {"nobody@example.com"}})
+	expectRedirect(t, resp, "/forgot")
+	if len(app.mail.Messages()) != sent {
+		t.Error("mail sent for an unknown email")
+	}
+
+	resp, body = app.get("/reset?token=" + token)
+	expectPage(t, resp, body, "Reset Password")
+	resp, body = app.post("/reset?token="+token, url.Values{"password": {"battery staple"}, "confirm": {"battery"}})
+	expectPage(t, resp, body, "Passwords do not match.")
+	resp, body = app.post("/reset?token="+token, url.Values{"password": {"correct horse"}, "confirm": {"correct horse"}})
+	expectPage(t, resp, body, "Password must differ from your last 4 passwords.")
+	resp, _ = app.post("/reset?token="+token, url.Values{"password": {"battery staple"}, "confirm": {"battery staple"}})
+	expectRedirect(t, resp, "/")
+
+	// The reset ended the session opened with the old password
+	resp, _ = app.get("/home")
+	expectRedirect(t, resp, "/")
+
+	// The link works once
+	resp, body = app.post("/reset?token="+token, url.Values{"password": {"another one"}, "confirm": {"another one"}})
+	expectPage(t, resp, body, "Invalid or expired token")
+
+	resp, _ = app.post("/", url.Values{"email": {"admin@example.com"}, "password": {"battery staple"}})
+	expectRedirect(t, resp, "/home")
+}
+
+// userLogin starts an end-user session for email in the client's cookie jar
+func (a *testApp) userLogin(email, password string) {
+	a.t.Helper()
+	resp, _ := a.post("/account/login", url.Values{"email": {email}, "password": {password}})
+	expectRedirect(a.t, resp, "/account/")
+}
+
+func TestAccountLogin(t *testing.T) {
+	app := newTestApp(t)
+	app.addUser("jane@example.com", "9876543210")
+
+	resp, body := app.get("/account/login")
+	expectPage(t, resp, body, `name="password"`)
+	resp, _ = app.get("/account/")
+	expectRedirect(t, resp, "/account/login")
+	resp, body = app.post("/account/login", url.Values{"email": {"jane@example.com"}, "password": {"wrong password"}})
+	expectPage(t, resp, body, "Invalid email or password")
+
+	app.userLogin("jane@example.com", "correct horse")
+	resp, body = app.get("/account/")
+	expectPage(t, resp, body, "jane@example.com")
+
+	// The user session never opens the admin pages
+	resp, _ = app.get("/home")
+	expectRedirect(t, resp, "/")
+
+	resp, _ = app.post("/account/logout", url.Values{})
+	expectRedirect(t, resp, "/account/login")
+	resp, _ = app.get("/account/")
+	expectRedirect(t, resp, "/account/login")
+}
+
+func TestAccountProfile(t *testing.T) {
+	app := newTestApp(t)
+	user := app.addUser("jane@example.com", "9876543210")
+	app.addUser("joe@example.com", "9876543211")
+	app.userLogin("jane@example.com", "correct horse")
+
+	resp, body := app.get("/account/profile")
+	expectPage(t, resp, body, `value="9876543210"`)
+
+	resp, body = app.post("/account/profile", userForm("jane@example.com", "9876543211"))
+	expectPage(t, resp, body, "Mobile number already registered")
+
+	form := userForm("jane@example.com", "9876543212")
+	form.Set("username", "Jane Doe")
+	resp, _ = app.post("/account/profile", form)
+	expectRedirect(t, resp, "/account/")
+	app.expectFlash(resp, "Profile updated.")
+	stored, _ := app.findUser(user.ID)
+	if stored.Username != "Jane Doe" || stored.Mobile != "9876543212" || stored.Email != "jane@example.com" {
+		t.Errorf("stored user %+v", stored)
+	}
+}
+
+func TestAccountPasswordReset(t *testing.T) {
+	app := newTestApp(t)
+	app.addUser("jane@example.com", "9876543210")
+
+	resp, body := app.get("/account/forgot")
+	expectPage(t, resp, body, `name="email"`)
+	resp, _ = app.post("/account/forgot", url.Values{"email": {"jane@example.com"}})
+	expectRedirect(t, resp, "/account/forgot")
+	app.expectFlash(resp, "If the email exists, a reset link will be sent.")
+	token := app.lastToken("jane@example.com")
+
+	resp, body = app.post("/account/reset?token="+token, url.Values{"password": {"battery staple"}, "confirm": {"battery"}})
+	expectPage(t, resp, body, "Passwords do not match.")
+	// The token is only used up once the new password is accepted
+	resp, body = app.post("/account/reset?token="+token, url.Values{"password": {"correct horse"}, "confirm": {"correct horse"}})
+	expectPage(t, resp, body, "Password must differ from your last 4 passwords.")
+	resp, _ = app.post("/account/reset?token="+token, url.Values{"password": {"battery staple"}, "confirm": {"battery staple"}})
+	expectRedirect(t, resp, "/account/login")
+
+	// The link works once
+	resp, body = app.post("/account/reset?token="+token, url.Values{"password": {"another one"}, "confirm": {"another one"}})
+	expectPage(t, resp, body, "Invalid or expired token")
+
+	app.userLogin("jane@example.com", "battery staple")
+}
+
+func TestAccountPasswordChange(t *testing.T) {
+	app := newTestApp(t)
+	user := app.addUser("jane@example.com", "9876543210")
+	app.userLogin("jane@example.com", "correct horse")
+
+	resp, body := app.get("/account/password")
+	expectPage(t, resp, body, `name="current"`)
+
+	tests := []struct {
+		name string
+		form url.Values
+		want string
+	}{
+		{"wrong current", url.Values{"current": {"wrong"}, "password": {"battery staple"}, "confirm": {"battery staple"}}, "Current password is not correct"},
+		{"too short", url.Values{"current": {"correct horse"}, "password": {"short"}, "confirm": {"short"}}, "Password must be at least 8 characters long."},
+		{"reused", url.Values{"current": {"correct horse"}, "password": {"correct horse"}, "confirm": {"correct horse"}}, "Password must differ from your last 4 passwords."},
+		{"common", url.Values{"current": {"correct horse"}, "password": {"password"}, "confirm": {"password"}}, "too common"},
+		{"mismatch", url.Values{"current": {"correct horse"}, "password": {"battery staple"}, "confirm": {"battery"}}, "Passwords do not match"},
+	}
+	for _, tt := range tests {
+		resp, body := app.post("/account/password", tt.form)
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, tt.want) {
+			t.Errorf("%s: got %d, want %d with %q", tt.name, resp.StatusCode, http.StatusBadRequest, tt.want)
+		}
+	}
+
+	resp, _ = app.post("/account/password", url.Values{"current": {"correct horse"}, "password": {"battery staple"}, "confirm": {"battery staple"}})
+	expectRedirect(t, resp, "/account/")
+	// This browser got a new session, the old one ended with the change
+	app.expectFlash(resp, "Password changed.")
+	if stored, _ := app.findUser(user.ID); len(stored.PasswordHistory) != 1 {
+		t.Errorf("password history %d, want 1", len(stored.PasswordHistory))
+	}
+
+	app.post("/account/logout", url.Values{})
+	app.userLogin("jane@example.com", "battery staple")
+}
+
+func TestEmails(t *testing.T) {
+	app := newTestApp(t)
+	app.login()
+	ctx := context.Background()
+
+	dead := model.OutboxEmail{
+		ID: primitive.NewObjectID(), To: []string{"jane@example.com"}, Subject: "Reset", Text: "Hello",
+		Status: model.OutboxDead, Attempts: 6, LastError: "connection refused", CreatedAt: time.Now(),
+	}
+	if err := app.repos.Outbox.Insert(ctx, dead); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body := app.get("/emails")
+	expectPage(t, resp, body, "connection refused")
+
+	resp, _ = app.post("/emails/"+dead.ID.Hex()+"/resend", url.Values{})
+	expectRedirect(t, resp, "/emails")
+	if failed, _ := app.repos.Outbox.ListFailed(ctx, 10); len(failed) != 0 {
+		t.Errorf("resent email still failed: %+v", failed)
+	}
+	email, err := app.repos.Outbox.Claim(ctx, time.Now(), time.Now().Add(time.Minute))
+	if err != nil || email.ID != dead.ID || email.Attempts != 0 {
+		t.Errorf("claimed %+v, %v", email, err)
+	}
+
+	resp, _ = app.post("/emails/bad/resend", url.Values{})
+	expectRedirect(t, resp, "/emails")
+	app.expectFlash(resp, "Invalid ID")
+}
+
+func TestEmailPreview(t *testing.T) {
+	app := newTestApp(t)
+	app.login()
+
+	for query, want := range map[string]string{
+		"":                             "Subject: Password Reset Link",
+		"?name=verification&locale=fr": "Subject: Vérifiez votre adresse e-mail",
+		"?name=invite&locale=fr":       "Subject: Vous êtes invité",
+		"?name=notification":           "Subject: Your profile was updated",
+		"?name=notification&locale=fr": "Ouvrir",
+		"?name=unknown":                "emails:",
+	} {
+		resp, body := app.get("/emails/preview" + query)
+		expectPage(t, resp, body, want)
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	app := newTestApp(t)
+	app.addAdmin("admin@example.com", "correct horse")
+
+	form := url.Values{"email": {"admin@example.com"}, "password": {"correct horse"}}
+	resp, err := app.client.PostForm(app.srv.URL+"/", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readBody(t, resp)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("post without a token: got %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+}
+
+func TestRouting(t *testing.T) {
+	app := newTestApp(t)
+	app.login()
+
+	for _, tt := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/no/such/page", http.StatusNotFound},
+		{http.MethodGet, "/api/nothing", http.StatusNotFound},
+		{http.MethodPut, "/home", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/users/" + primitive.NewObjectID().Hex(), http.StatusMethodNotAllowed},
+	} {
+		req, _ := http.NewRequest(tt.method, app.srv.URL+tt.path, nil)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set(csrf.HeaderName, testCSRFToken)
+		resp, err := app.client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Error  string `json:"error"`
+			Status int    `json:"status"`
+		}
+		if err := json.Unmarshal([]byte(readBody(t, resp)), &body); err != nil || resp.StatusCode != tt.status || body.Status != tt.status {
+			t.Errorf("%s %s: got %d %+v, want %d", tt.method, tt.path, resp.StatusCode, body, tt.status)
+		}
+		if tt.status == http.StatusMethodNotAllowed && resp.Header.Get("Allow") == "" {
+			t.Errorf("%s %s: no Allow header", tt.method, tt.path)
+		}
+	}
+}
+
+func TestAPI(t *testing.T) {
+	app := newTestApp(t)
+	user := app.addUser("jane@example.com", "9876543210")
+	app.addUser("joe@example.com", "9876543211")
+
+	resp, _ := app.get("/api/users")
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("without a session: got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	app.login()
+
+	resp, body := app.get("/api/users?field=email&order=asc")
+	var list struct {
+		Users []struct {
+			ID       string   `json:"id"`
+			Email    string   `json:"email"`
+			Sports   []string `json:"sports"`
+			Password string   `json:"password"`
+		} `json:"users"`
+		Total int64 `json:"total"`
+	}
+	if err := json.Unmarshal([]byte(body), &list); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %d, %v", resp.StatusCode, err)
+	}
+	if list.Total != 2 || len(list.Users) != 2 || list.Users[0].Email != "jane@example.com" || list.Users[0].Password != "" {
+		t.Errorf("listed %+v", list)
+	}
+
+	resp, body = app.get("/api/users/" + user.ID.Hex())
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `"email":"jane@example.com"`) || !strings.Contains(body, `"sports":["cricket"]`) {
+		t.Errorf("got %d %s", resp.StatusCode, body)
+	}
+
+	for path, status := range map[string]int{
+		"/api/users/bad": http.StatusBadRequest,
+		"/api/users/" + primitive.NewObjectID().Hex(): http.StatusNotFound,
+		"/api/users?page=9223372036854775807":         http.StatusInternalServerError, // the offset would overflow
+	} {
+		if resp, _ := app.get(path); resp.StatusCode != status {
+			t.Errorf("%s: got %d, want %d", path, resp.StatusCode, status)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// Check is one readiness condition, a nil error means it passes
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Health serves the probe endpoints. They return JSON and are registered without RequireLogin.
+type Health struct {
+	checks []Check
+}
+
+func NewHealth(checks ...Check) *Health {
+	return &Health{checks: checks}
+}
+
+// Healthz only tells that the process is alive and serving requests
+func (hl *Health) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz runs every check and answers 503 when any of them fails
+func (hl *Health) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	status := http.StatusOK
+	results := make(map[string]string, len(hl.checks))
+	for _, c := range hl.checks {
+		if err := c.Run(ctx); err != nil {
+			results[c.Name] = err.Error()
+			status = http.StatusServiceUnavailable
+		} else {
+			results[c.Name] = "ok"
+		}
+	}
+
+	overall := "ok"
+	if status != http.StatusOK {
+		overall = "unavailable"
+	}
+	writeJSON(w, status, map[string]any{"status": overall, "checks": results})
+}
+
+// Version reports the build information embedded by the Go toolchain
+func Version(w http.ResponseWriter, r *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		writeJSON(w, http.StatusOK, map[string]string{"version": "unknown"})
+		return
+	}
+
+	resp := map[string]string{
+		"module":     info.Main.Path,
+		"version":    info.Main.Version,
+		"go_version": info.GoVersion,
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			resp["revision"] = s.Value
+		case "vcs.time":
+			resp["build_time"] = s.Value
+		case "vcs.modified":
+			resp["modified"] = s.Value
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
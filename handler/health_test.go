@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewHealth().Healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	pass := Check{Name: "mongo", Run: func(ctx context.Context) error { return nil }}
+	fail := Check{Name: "mailer", Run: func(ctx context.Context) error { return errors.New("no sender address configured") }}
+
+	tests := []struct {
+		name   string
+		checks []Check
+		status int
+		want   map[string]string
+	}{
+		{"all pass", []Check{pass}, http.StatusOK, map[string]string{"mongo": "ok"}},
+		{"one fails", []Check{pass, fail}, http.StatusServiceUnavailable,
+			map[string]string{"mongo": "ok", "mailer": "no sender address configured"}},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		NewHealth(tt.checks...).Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var body struct {
+			Status string            `json:"status"`
+			Checks map[string]string `json:"checks"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if rec.Code != tt.status || len(body.Checks) != len(tt.want) {
+			t.Errorf("%s: got %d %+v, want %d", tt.name, rec.Code, body, tt.status)
+		}
+		for name, result := range tt.want {
+			if body.Checks[name] != result {
+				t.Errorf("%s: check %s = %q, want %q", tt.name, name, body.Checks[name], result)
+			}
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Version(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	var body map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("got %d, %v", rec.Code, err)
+	}
+	if body["go_version"] == "" && body["version"] != "unknown" {
+		t.Errorf("no build information in %v", body)
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"go2/live"
+	"go2/model"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// heartbeatInterval keeps idle streams open through proxies that close silent connections
+const heartbeatInterval = 25 * time.Second
+
+// UserEventsHandler streams user changes to the listing page as Server-Sent Events
+func (h *Handler) UserEventsHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// The stream outlives the server write timeout, which is meant for normal pages
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.WarnContext(r.Context(), "cannot lift the write deadline for the event stream", "error", err)
+	}
+
+	messages, unsubscribe := h.live.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would otherwise buffer the stream
+	w.WriteHeader(http.StatusOK)
+	// Tell the browser how long to wait before reconnecting
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case m, ok := <-messages:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(m)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", m.Type, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// CloseStreams ends every open event stream, call it when the server shuts down
+func (h *Handler) CloseStreams() {
+	h.live.Close()
+}
+
+// StreamCount returns the number of open event streams, exported as a metric
+func (h *Handler) StreamCount() int {
+	return h.live.Clients()
+}
+
+func liveMessage(event string, user model.User, fields []string) live.Message {
+	return live.Message{
+		Type:     event,
+		ID:       user.ID.Hex(),
+		Username: user.Username,
+		Email:    user.Email,
+		Verified: user.EmailVerified,
+		Mobile:   user.Mobile,
+		Fields:   fields,
+	}
+}
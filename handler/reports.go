@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"go2/flash"
+	"go2/model"
+	"go2/render"
+	"go2/reports"
+	"go2/repository"
+	"go2/validator"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReportsHandler lists the scheduled reports with a form to add one
+func (h *Handler) ReportsHandler(w http.ResponseWriter, r *http.Request) {
+	setNoCacheHeaders(w)
+
+	form := model.ReportSchedule{
+		Kind:      model.ReportNewUsersByCountry,
+		Frequency: model.FrequencyWeekly,
+		Weekday:   time.Monday,
+		Hour:      6,
+	}
+	h.renderReports(w, r, http.StatusOK, form, "", nil)
+}
+
+func (h *Handler) CreateReportHandler(w http.ResponseWriter, r *http.Request) {
+	email, _ := GetSessionEmail(r)
+	recipients := r.FormValue("recipients")
+
+	schedule := model.ReportSchedule{
+		Name:       strings.TrimSpace(r.FormValue("name")),
+		Kind:       r.FormValue("kind"),
+		Frequency:  r.FormValue("frequency"),
+		Recipients: splitRecipients(recipients),
+		CreatedBy:  email,
+		CreatedAt:  time.Now(),
+	}
+	// Bad numbers are left out of range, so the validator reports them
+	schedule.Hour = formInt(r, "hour")
+	if schedule.Frequency == model.FrequencyWeekly {
+		schedule.Weekday = time.Weekday(formInt(r, "weekday"))
+	}
+
+	errs := validator.ValidateReportSchedule(schedule)
+	if errs.Any() {
+		h.renderReports(w, r, http.StatusBadRequest, schedule, recipients, errs)
+		return
+	}
+	schedule.NextRunAt = reports.NextRun(schedule, time.Now())
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.repos.Reports.Insert(ctx, schedule); err != nil {
+		flash.AddError(w, r, "Report could not be saved")
+	} else {
+		flash.AddSuccess(w, r, "Report scheduled, the first one is sent "+schedule.NextRunAt.Format("Mon 2006-01-02 15:04 MST"))
+	}
+	http.Redirect(w, r, "/reports", http.StatusSeeOther)
+}
+
+func (h *Handler) DeleteReportHandler(w http.ResponseWriter, r *http.Request) {
+	objID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		flash.AddError(w, r, "Invalid ID")
+		http.Redirect(w, r, "/reports", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.repos.Reports.Delete(ctx, objID); err != nil {
+		flash.AddError(w, r, "Report could not be deleted")
+	} else {
+		flash.AddSuccess(w, r, "Report deleted")
+	}
+	http.Redirect(w, r, "/reports", http.StatusSeeOther)
+}
+
+// RunReportHandler makes a report due now, the scheduler sends it on its next poll
+func (h *Handler) RunReportHandler(w http.ResponseWriter, r *http.Request) {
+	objID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		flash.AddError(w, r, "Invalid ID")
+		http.Redirect(w, r, "/reports", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.repos.Reports.RunNow(ctx, objID, time.Now()); err != nil {
+		flash.AddError(w, r, "Report could not be started")
+	} else {
+		flash.AddInfo(w, r, "Report will be sent within a minute")
+	}
+	http.Redirect(w, r, "/reports", http.StatusSeeOther)
+}
+
+// ReportFileHandler downloads a report that was too large to send as an attachment
+func (h *Handler) ReportFileHandler(w http.ResponseWriter, r *http.Request) {
+	objID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	file, err := h.repos.ReportFiles.Open(ctx, objID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "This report has expired, run it again from the reports page.", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Report could not be loaded", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename}))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(file.Data)
+}
+
+func (h *Handler) renderReports(w http.ResponseWriter, r *http.Request, status int, form model.ReportSchedule, recipients string, errs validator.Errors) {
+	data := model.ReportsPageData{
+		Title:       "Reports",
+		Kinds:       reports.Kinds,
+		KindNames:   make(map[string]string, len(reports.Kinds)),
+		Frequencies: []string{model.FrequencyDaily, model.FrequencyWeekly},
+		Weekdays:    []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday},
+		Form:        form,
+		Recipients:  recipients,
+		Errors:      errs,
+	}
+	for _, k := range reports.Kinds {
+		data.KindNames[k] = reports.Describe(k)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	schedules, err := h.repos.Reports.List(ctx)
+	if err != nil {
+		data.Error = "Error loading reports"
+	}
+	data.Schedules = schedules
+	render.RenderTemplateWithStatus(w, r, status, "Reports.html", data)
+}
+
+// splitRecipients accepts addresses separated by commas, semicolons or whitespace
+func splitRecipients(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+	seen := make(map[string]bool, len(fields))
+	var out []string
+	for _, f := range fields {
+		if key := strings.ToLower(f); !seen[key] {
+			seen[key] = true
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func formInt(r *http.Request, name string) int {
+	n, err := strconv.Atoi(r.FormValue(name))
+	if err != nil {
+		return -1
+	}
+	return n
+}
@@ -1,53 +1,41 @@
 package handler
 
 import (
-	"math/rand"
+	"go2/utils"
 	"net/http"
-	"os"
-	"strconv"
 	"sync"
-	"time"
 )
 
-var (
-	sessionStore  = make(map[string]string) // session_id -> email
-	sessionMutex  = sync.Mutex{}
-	userPageLimit int
-)
-
-func InitSession() {
-	if limitStr := os.Getenv("USER_PAGE_LIMIT"); limitStr != "" {
-		if val, err := strconv.Atoi(limitStr); err == nil && val > 0 {
-			userPageLimit = val
-			return
-		}
-	}
-	userPageLimit = 5
+// sessionStore keeps sessions in memory, token -> owner. Admins and end users each have
+// their own store and cookie, so a session of one kind is never accepted as the other.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]string
+	cookie   string
+	path     string // the cookie is only sent below this path
 }
 
-// GenerateSecureToken returns a pseudo-random session ID (64-char)
-func GenerateSecureToken(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	b := make([]byte, length)
-	rand.Seed(time.Now().UnixNano())
-	for i := range b {
-		b[i] = charset[rand.Intn(len(charset))]
-	}
-	return string(b)
+func newSessionStore(cookie, path string) *sessionStore {
+	return &sessionStore{sessions: make(map[string]string), cookie: cookie, path: path}
 }
 
-// SetSession sets a new session ID in memory and in the client's cookie
-func SetSession(w http.ResponseWriter, email string) {
-	token := GenerateSecureToken(64)
+var (
+	adminSessions = newSessionStore("session_id", "/")          // owner is the admin email
+	userSessions  = newSessionStore("user_session", "/account") // owner is the user ID
+)
 
-	sessionMutex.Lock()
-	sessionStore[token] = email
-	sessionMutex.Unlock()
+// set starts a session for owner and sets the cookie
+func (s *sessionStore) set(w http.ResponseWriter, owner string) {
+	token := utils.GenerateSecureToken(32)
+
+	s.mu.Lock()
+	s.sessions[token] = owner
+	s.mu.Unlock()
 
 	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
+		Name:     s.cookie,
 		Value:    token,
-		Path:     "/",
+		Path:     s.path,
 		MaxAge:   3600,
 		HttpOnly: true,                 //JS can't access the cookie
 		Secure:   false,                // true if you use HTTPS
@@ -55,50 +43,110 @@ func SetSession(w http.ResponseWriter, email string) {
 	})
 }
 
-// GetSessionEmail returns the email for a valid session cookie
-func GetSessionEmail(r *http.Request) (string, bool) {
-	cookie, err := r.Cookie("session_id")
+// get returns the owner of the session in the request cookie
+func (s *sessionStore) get(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(s.cookie)
 	if err != nil || cookie.Value == "" {
 		return "", false
 	}
 
-	sessionMutex.Lock()
-	defer sessionMutex.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	email, ok := sessionStore[cookie.Value]
-	return email, ok
+	owner, ok := s.sessions[cookie.Value]
+	return owner, ok
 }
 
-// ClearSession deletes session ID from memory and clears client cookie
-func ClearSession(w http.ResponseWriter, r *http.Request) {
-	//Get the session cookie, and delete the session from server-side memory map
-	cookie, err := r.Cookie("session_id")
-	if err == nil {
-		sessionMutex.Lock()
-		delete(sessionStore, cookie.Value)
-		sessionMutex.Unlock()
-
-		//Overwrites the client cookie with empty value and expiry -1, which deletes it from browser.
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session_id",
-			Value:    "",
-			Path:     "/",
-			MaxAge:   -1, //Delete the cookie
-			HttpOnly: true,
-			Secure:   false,
-			SameSite: http.SameSiteLaxMode,
-		})
+// clear deletes the session from memory and the cookie from the browser
+func (s *sessionStore) clear(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(s.cookie)
+	if err != nil {
+		return
 	}
+	s.mu.Lock()
+	delete(s.sessions, cookie.Value)
+	s.mu.Unlock()
+
+	//Overwrites the client cookie with empty value and expiry -1, which deletes it from browser.
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookie,
+		Value:    "",
+		Path:     s.path,
+		MaxAge:   -1, //Delete the cookie
+		HttpOnly: true,
+		Secure:   false,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *sessionStore) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// owners returns the distinct owners that have a session
+func (s *sessionStore) owners() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var owners []string
+	for _, owner := range s.sessions {
+		if !seen[owner] {
+			seen[owner] = true
+			owners = append(owners, owner)
+		}
+	}
+	return owners
 }
 
-func GetUserPageLimit() int {
-	return userPageLimit
+// clearOwner ends every session of owner, the cookies become invalid on the next request
+func (s *sessionStore) clearOwner(owner string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for token, o := range s.sessions {
+		if o == owner {
+			delete(s.sessions, token)
+		}
+	}
+}
+
+// SetSession sets a new admin session ID in memory and in the client's cookie
+func SetSession(w http.ResponseWriter, email string) {
+	adminSessions.set(w, email)
+}
+
+// GetSessionEmail returns the email for a valid admin session cookie
+func GetSessionEmail(r *http.Request) (string, bool) {
+	return adminSessions.get(r)
+}
+
+// ClearSession deletes the admin session from memory and clears the client cookie
+func ClearSession(w http.ResponseWriter, r *http.Request) {
+	adminSessions.clear(w, r)
+}
+
+// SessionCount returns the number of admin and user sessions, exported as a metric
+func SessionCount() int {
+	return adminSessions.count() + userSessions.count()
+}
+
+// SessionEmails returns the distinct admin emails that have a session
+func SessionEmails() []string {
+	return adminSessions.owners()
+}
+
+// ClearSessionsFor ends every session of the admin email
+func ClearSessionsFor(email string) {
+	adminSessions.clearOwner(email)
 }
 
 // RequireLogin is middleware to protect authenticated routes
-func RequireLogin(next http.HandlerFunc) http.HandlerFunc {
+func RequireLogin(next http.Handler) http.Handler {
 	//Prevents caching to avoid going back after logout.
-	return func(w http.ResponseWriter, r *http.Request) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		setNoCacheHeaders(w)
 
 		_, ok := GetSessionEmail(r)
@@ -106,8 +154,21 @@ func RequireLogin(next http.HandlerFunc) http.HandlerFunc {
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
-		next(w, r)
-	}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAPILogin is RequireLogin for API routes, it answers 401 JSON instead of redirecting
+func RequireAPILogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setNoCacheHeaders(w)
+
+		if _, ok := GetSessionEmail(r); !ok {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // Helps prevent back-button access to protected content after logout.
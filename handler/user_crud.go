@@ -1,212 +1,207 @@
 package handler
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
+	"go2/flash"
 	"go2/model"
-	"go2/mongo"
 	"go2/render"
-	"go2/utils"
+	"go2/repository"
+	"go2/validator"
 	"io"
+	"log/slog"
 	"net/http"
-	"regexp"
 	"strings"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
-	countries, err := utils.GetCountriesFromDB()
+// duplicateMessages are shown when a unique index rejects a value
+var duplicateMessages = map[string]string{
+	"email":  "Email already used, try a different one.",
+	"mobile": "Mobile number already registered",
+}
+
+// RegisterFormHandler shows the empty registration form
+func (h *Handler) RegisterFormHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	countries, err := h.repos.Countries.List(ctx)
 	if err != nil {
-		render.RenderTemplateWithData(w, "Registration.html", model.RegisterPageData{
+		render.RenderTemplateWithData(w, r, "Registration.html", model.RegisterPageData{
 			Error: "Error fetching countries: " + err.Error(),
 		})
 		return
 	}
+	render.RenderTemplateWithData(w, r, "Registration.html", model.RegisterPageData{
+		Countries: countries,
+		Title:     "Add User",
+	})
+}
 
-	if r.Method == http.MethodPost {
-		username := r.FormValue("username")
-		password := r.FormValue("password")
-		confirm := r.FormValue("confirm")
-		email := r.FormValue("email")
-		mobile := r.FormValue("mobile")
-		address := r.FormValue("address")
-		gender := r.FormValue("gender")
-		sports := r.Form["sports"]
-		dobStr := r.FormValue("dob")
-		country := r.FormValue("country")
-		joinedSports := strings.Join(sports, ",")
-
-		user := model.User{
-			Username: username,
-			Email:    email,
-			Mobile:   mobile,
-			Address:  address,
-			Gender:   gender,
-			Sports:   joinedSports,
-			DOB:      dobStr,
-			Country:  country,
-		}
+func (h *Handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
 
-		//sports
-		sportsMap := make(map[string]bool)
-		for _, s := range sports {
-			sportsMap[s] = true
-		}
+	countries, err := h.repos.Countries.List(ctx)
+	if err != nil {
+		render.RenderTemplateWithData(w, r, "Registration.html", model.RegisterPageData{
+			Error: "Error fetching countries: " + err.Error(),
+		})
+		return
+	}
 
-		//password
-		if password != confirm {
-			render.RenderTemplateWithData(w, "Registration.html", model.RegisterPageData{
-				Error:     "Passwords do not match",
-				Countries: countries,
-				User:      user,
-				SportsMap: sportsMap,
-			})
-			return
-		}
+	username := r.FormValue("username")
+	password := r.FormValue("password")
+	confirm := r.FormValue("confirm")
+	email := r.FormValue("email")
+	mobile := r.FormValue("mobile")
+	address := r.FormValue("address")
+	gender := r.FormValue("gender")
+	sports := r.Form["sports"]
+	dobStr := r.FormValue("dob")
+	country := r.FormValue("country")
+	joinedSports := strings.Join(sports, ",")
+
+	user := model.User{
+		Username: username,
+		Email:    email,
+		Password: password,
+		Mobile:   mobile,
+		Address:  address,
+		Gender:   gender,
+		Sports:   joinedSports,
+		DOB:      dobStr,
+		Country:  country,
+	}
 
-		//dob
-		dob, err := time.Parse("2006-01-02", dobStr)
-		if err != nil || dob.After(time.Now()) {
-			render.RenderTemplateWithData(w, "Registration.html", model.RegisterPageData{
-				Error:     "Invalid or future DOB",
-				Countries: countries,
-				User:      user,
-				SportsMap: sportsMap,
-			})
-			return
-		}
+	sportsMap := buildSportsMap(joinedSports)
 
-		//mobile number
-		match, err := regexp.MatchString(`^(\+\d{1,3})?\d{10}$`, mobile)
-		if err != nil || !match {
-			render.RenderTemplateWithData(w, "Registration.html", model.RegisterPageData{
-				Error:     "Invalid mobile number format",
-				Countries: countries,
-				User:      user,
-				SportsMap: sportsMap,
-			})
-			return
-		}
+	//validate every field, errors are shown next to each field
+	errs := validator.ValidateUser(user, validator.Create, countries)
+	if problems := h.passwords.Check(password); password != "" && len(problems) > 0 {
+		errs.Add("password", strings.Join(problems, " "))
+	}
+	validator.ConfirmPassword(errs, password, confirm)
 
-		//image
-		file, _, err := r.FormFile("image")
-		if err == nil {
-			defer file.Close()
-			imageBytes, err := io.ReadAll(file)
-			if err != nil {
-				render.RenderTemplateWithData(w, "Registration.html", model.RegisterPageData{
-					Error:     "Error in image uploading",
-					Countries: countries,
-					User:      user,
-					SportsMap: sportsMap,
-				})
-				return
-			}
-			user.Image = imageBytes //For storing the image
-		}
+	// The unique indexes are the real guard, this only reports both fields at once
+	if exists, err := h.repos.Users.EmailExists(ctx, email); err == nil && exists {
+		errs.Add("email", duplicateMessages["email"])
+	}
+	if exists, err := h.repos.Users.MobileExists(ctx, mobile); err == nil && exists {
+		errs.Add("mobile", duplicateMessages["mobile"])
+	}
+
+	user.Password = ""
+	if errs.Any() {
+		render.RenderTemplateWithData(w, r, "Registration.html", model.RegisterPageData{
+			Errors:    errs,
+			Countries: countries,
+			User:      user,
+			SportsMap: sportsMap,
+			Title:     "Add User",
+		})
+		return
+	}
 
-		//hashing password
-		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	//image
+	file, _, err := r.FormFile("image")
+	if err == nil {
+		defer file.Close()
+		imageBytes, err := io.ReadAll(file)
 		if err != nil {
-			render.RenderTemplateWithData(w, "Registration.html", model.RegisterPageData{
-				Error:     "Password hashing failed",
+			render.RenderTemplateWithData(w, r, "Registration.html", model.RegisterPageData{
+				Errors:    map[string]string{"image": "Error in image uploading"},
 				Countries: countries,
 				User:      user,
 				SportsMap: sportsMap,
+				Title:     "Add User",
 			})
 			return
 		}
+		user.Image = imageBytes //For storing the image
+	}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
+	//hashing password
+	hashed, err := h.hasher.Hash(password)
+	if err != nil {
+		render.RenderTemplateWithData(w, r, "Registration.html", model.RegisterPageData{
+			Error:     "Password hashing failed",
+			Countries: countries,
+			User:      user,
+			SportsMap: sportsMap,
+			Title:     "Add User",
+		})
+		return
+	}
 
-		if mongo.EmailExists(ctx, email) {
-			render.RenderTemplateWithData(w, "Registration.html", model.RegisterPageData{
-				Error:     "Email already used, try a different one.",
-				Countries: countries,
-				User:      user,
-				SportsMap: sportsMap,
-			})
-			return
-		}
+	user.Password = hashed
+	// The ID is set here so the webhook event can carry it
+	user.ID = primitive.NewObjectID()
 
-		if mongo.MobileExists(ctx, mobile) {
-			render.RenderTemplateWithData(w, "Registration.html", model.RegisterPageData{
-				Error:     "Mobile number already registered",
-				Countries: countries,
-				User:      user,
-				SportsMap: sportsMap,
-			})
-			return
+	err = h.repos.Users.Insert(ctx, user)
+	if err != nil {
+		data := model.RegisterPageData{
+			Countries: countries,
+			User:      user,
+			SportsMap: sportsMap,
+			Title:     "Add User",
 		}
-		user.Password = string(hashed)
-
-		err = mongo.InsertUser(ctx, user)
-		if err != nil {
-			render.RenderTemplateWithData(w, "Registration.html", model.RegisterPageData{
-				Error:     "Registration failed: " + err.Error(),
-				Countries: countries,
-				User:      user,
-				SportsMap: sportsMap,
-			})
-			return
+		if field := repository.DuplicateField(err); field != "" {
+			data.Errors = map[string]string{field: duplicateMessages[field]}
+		} else {
+			data.Error = "Registration failed: " + err.Error()
 		}
-		utils.SetFlashMessage(w, "User successfully registered!")
-		http.Redirect(w, r, "/home", http.StatusSeeOther)
+		render.RenderTemplateWithData(w, r, "Registration.html", data)
 		return
 	}
-	render.RenderTemplateWithData(w, "Registration.html", model.RegisterPageData{
-		Countries: countries,
-		Title:     "Add User",
-	})
+	h.publishUser(ctx, model.EventUserCreated, user)
+	if err := h.sendVerification(ctx, r, user); err != nil {
+		slog.ErrorContext(ctx, "failed to send verification email", "user_id", user.ID.Hex(), "error", err)
+		flash.AddWarning(w, r, "The verification email could not be sent, resend it from the listing.")
+	}
+	flash.AddSuccess(w, r, "User successfully registered!")
+	http.Redirect(w, r, "/home", http.StatusSeeOther)
 }
 
-func EditHandler(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
-	if idStr == "" {
-		render.RenderTemplateWithData(w, "Home.html", model.HomePageData{Error: "Missing user ID"})
-		return
-	}
+func (h *Handler) EditHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
 
 	//Convert string ID to ObjectId safely...
 	objID, err := primitive.ObjectIDFromHex(idStr)
 	if err != nil {
-		render.RenderTemplateWithData(w, "Home.html", model.HomePageData{Error: "Invalid ID format"})
+		render.Error(w, r, http.StatusNotFound, "There is no user with this ID.")
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	user, err := mongo.FindUserByID(ctx, objID)
+	user, err := h.repos.Users.FindByID(ctx, objID)
+	if errors.Is(err, repository.ErrNotFound) {
+		render.Error(w, r, http.StatusNotFound, "There is no user with this ID.")
+		return
+	}
 	if err != nil {
-		render.RenderTemplateWithData(w, "Home.html", model.HomePageData{
-			Error: "User not found",
-		})
+		render.Error(w, r, http.StatusInternalServerError, "")
 		return
 	}
 
 	if len(user.Image) > 0 {
 		user.ImageBase64 = base64.StdEncoding.EncodeToString(user.Image)
 	}
-	countries, _ := utils.GetCountriesFromDB()
+	countries, _ := h.repos.Countries.List(ctx)
 
-	sportsMap := make(map[string]bool)
-	for _, sport := range strings.Split(user.Sports, ",") {
-		sport = strings.TrimSpace(sport)
-		if sport != "" {
-			sportsMap[sport] = true
-		}
-	}
+	sportsMap := buildSportsMap(user.Sports)
 	if len(user.DOB) > 10 {
 		user.DOB = user.DOB[:10]
 	}
 
-	render.RenderTemplateWithData(w, "Edit.html", model.EditPageData{
+	render.RenderTemplateWithData(w, r, "Edit.html", model.EditPageData{
 		Title:     "Edit User",
 		User:      user,
 		Countries: countries,
@@ -214,96 +209,179 @@ func EditHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func UpdateHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Redirect(w, r, "/home", http.StatusSeeOther)
-		return
-	}
-
-	idStr := r.FormValue("id")
+func (h *Handler) UpdateHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
 	objID, err := primitive.ObjectIDFromHex(idStr)
 	if err != nil {
-		utils.SetFlashMessage(w, "Invalid ID")
+		flash.AddError(w, r, "Invalid ID")
 		http.Redirect(w, r, "/home", http.StatusSeeOther)
 		return
 	}
 
-	username := r.FormValue("username")
-	mobile := r.FormValue("mobile")
-	address := r.FormValue("address")
-	gender := r.FormValue("gender")
-	dobStr := r.FormValue("dob")
-	country := r.FormValue("country")
-	sports := strings.Join(r.Form["sports"], ",")
-	removeImage := r.FormValue("remove_image") == "1"
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
 
-	match, _ := regexp.MatchString(`^(\+\d{1,3})?\d{10}$`, mobile)
-	if !match {
-		utils.SetFlashMessage(w, "Invalid mobile format")
+	// Load the stored user, the image is needed to re-render the form
+	user, err := h.repos.Users.FindByID(ctx, objID)
+	if err != nil {
+		flash.AddError(w, r, "User not found")
 		http.Redirect(w, r, "/home", http.StatusSeeOther)
 		return
 	}
-	dob, err := time.Parse("2006-01-02", dobStr)
-	if err != nil || dob.After(time.Now()) {
-		utils.SetFlashMessage(w, "Invalid DOB")
-		http.Redirect(w, r, "/home", http.StatusSeeOther)
+
+	user, countries, errs, err := h.saveProfile(ctx, r, user)
+	if errs.Any() {
+		renderEditForm(w, r, "Edit.html", user, countries, errs)
 		return
 	}
+	if err != nil {
+		flash.AddError(w, r, "Update failed: "+err.Error())
+	} else {
+		flash.AddSuccess(w, r, "User successfully updated!")
+	}
+	http.Redirect(w, r, "/home", http.StatusSeeOther)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// saveProfile applies the edit form to the stored user and saves it. Admins and users editing
+// their own profile go through it, so both follow the same rules. A changed email is marked
+// unverified and gets a new verification link. Field errors come back in errs, anything else in err.
+func (h *Handler) saveProfile(ctx context.Context, r *http.Request, user model.User) (model.User, []string, validator.Errors, error) {
+	before := user
+
+	user.Username = r.FormValue("username")
+	user.Email = strings.TrimSpace(r.FormValue("email"))
+	user.Mobile = r.FormValue("mobile")
+	user.Address = r.FormValue("address")
+	user.Gender = r.FormValue("gender")
+	user.DOB = r.FormValue("dob")
+	user.Country = r.FormValue("country")
+	user.Sports = strings.Join(r.Form["sports"], ",")
+	removeImage := r.FormValue("remove_image") == "1"
+
+	// A new address has to be verified again
+	emailChanged := user.Email != before.Email
+	if emailChanged {
+		user.EmailVerified = false
+	}
 
-	update := bson.M{
-		"username": username,
-		"mobile":   mobile,
-		"address":  address,
-		"gender":   gender,
-		"sports":   sports,
-		"dob":      dobStr,
-		"country":  country,
+	countries, _ := h.repos.Countries.List(ctx)
+	errs := validator.ValidateUser(user, validator.Update, countries)
+	if errs.Any() {
+		return user, countries, errs, nil
 	}
 
+	// Keep the stored image unless a new one is uploaded or removal is requested
 	file, _, err := r.FormFile("image")
 	if err == nil {
 		defer file.Close()
-		imageData, _ := io.ReadAll(file)
-		update["image"] = imageData
+		imageData, err := io.ReadAll(file)
+		if err != nil {
+			return user, countries, validator.Errors{"image": "Error in image uploading"}, nil
+		}
+		user.Image = imageData
 	} else if removeImage {
-		update["image"] = nil
+		user.Image = nil
 	}
 
-	err = mongo.UpdateUserByID(ctx, objID, update)
+	err = h.repos.Users.Update(ctx, user)
+	if field := repository.DuplicateField(err); field != "" {
+		return user, countries, validator.Errors{field: duplicateMessages[field]}, nil
+	}
 	if err != nil {
-		utils.SetFlashMessage(w, "Update failed: "+err.Error())
-	} else {
-		utils.SetFlashMessage(w, "User successfully updated!")
+		return user, countries, nil, err
 	}
-	http.Redirect(w, r, "/home", http.StatusSeeOther)
-}
-
-func DeleteHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Redirect(w, r, "/home", http.StatusSeeOther)
-		return
+	h.publishUser(ctx, model.EventUserUpdated, user, changedFields(before, user)...)
+	if emailChanged {
+		if err := h.sendVerification(ctx, r, user); err != nil {
+			slog.ErrorContext(ctx, "failed to send verification email", "user_id", user.ID.Hex(), "error", err)
+		}
 	}
+	return user, countries, nil, nil
+}
 
-	idStr := r.FormValue("id")
+func (h *Handler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
 
 	objID, err := primitive.ObjectIDFromHex(idStr)
 	if err != nil {
-		utils.SetFlashMessage(w, "Invalid ID")
+		flash.AddError(w, r, "Invalid ID")
 		http.Redirect(w, r, "/home", http.StatusSeeOther)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	err = mongo.DeleteUserByID(ctx, objID)
+	// Loaded first so the webhook event can describe the deleted user
+	user, findErr := h.repos.Users.FindByID(ctx, objID)
+
+	err = h.repos.Users.Delete(ctx, objID)
 	if err != nil {
-		utils.SetFlashMessage(w, "Error deleting user")
+		flash.AddError(w, r, "Error deleting user")
 	} else {
-		utils.SetFlashMessage(w, "User deleted!")
+		if findErr != nil {
+			user = model.User{ID: objID}
+		}
+		h.publishUser(ctx, model.EventUserDeleted, user)
+		flash.AddSuccess(w, r, "User deleted!")
 	}
 	http.Redirect(w, r, "/home", http.StatusSeeOther)
 }
+
+// changedFields names the profile fields that differ between two versions of a user
+func changedFields(before, after model.User) []string {
+	var fields []string
+	for _, f := range []struct {
+		name      string
+		old, next string
+	}{
+		{"username", before.Username, after.Username},
+		{"email", before.Email, after.Email},
+		{"mobile", before.Mobile, after.Mobile},
+		{"address", before.Address, after.Address},
+		{"gender", before.Gender, after.Gender},
+		{"sports", before.Sports, after.Sports},
+		{"dob", before.DOB, after.DOB},
+		{"country", before.Country, after.Country},
+	} {
+		if f.old != f.next {
+			fields = append(fields, f.name)
+		}
+	}
+	if before.EmailVerified != after.EmailVerified {
+		fields = append(fields, "email_verified")
+	}
+	if !bytes.Equal(before.Image, after.Image) {
+		fields = append(fields, "image")
+	}
+	return fields
+}
+
+// renderEditForm shows the edit form again with the submitted values and the field errors
+func renderEditForm(w http.ResponseWriter, r *http.Request, temp string, user model.User, countries []string, errs validator.Errors) {
+	if len(user.Image) > 0 {
+		user.ImageBase64 = base64.StdEncoding.EncodeToString(user.Image)
+	}
+	if len(user.DOB) > 10 {
+		user.DOB = user.DOB[:10]
+	}
+	render.RenderTemplateWithData(w, r, temp, model.EditPageData{
+		Title:     "Edit User",
+		User:      user,
+		Countries: countries,
+		SportsMap: buildSportsMap(user.Sports),
+		Errors:    errs,
+	})
+}
+
+// buildSportsMap turns the comma separated sports into a lookup used to tick the checkboxes
+func buildSportsMap(sports string) map[string]bool {
+	sportsMap := make(map[string]bool)
+	for _, sport := range strings.Split(sports, ",") {
+		sport = strings.TrimSpace(sport)
+		if sport != "" {
+			sportsMap[sport] = true
+		}
+	}
+	return sportsMap
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"go2/emails"
+	"go2/flash"
+	"go2/model"
+	"go2/repository"
+	"go2/utils"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// verificationExpiry is how long a verification link works
+const verificationExpiry = 48 * time.Hour
+
+// sendVerification queues the verification email for the user's current address. Issuing the
+// token replaces any older link, so a link sent to a previous address stops working.
+func (h *Handler) sendVerification(ctx context.Context, r *http.Request, user model.User) error {
+	rawToken := utils.GenerateSecureToken(64)
+	tokenHash := utils.HashToken(model.TokenPurposeVerifyEmail, rawToken)
+	if err := h.repos.Tokens.Issue(ctx, user.ID, model.TokenPurposeVerifyEmail, tokenHash, time.Now().Add(verificationExpiry)); err != nil {
+		return err
+	}
+
+	data := emails.VerificationData{Name: user.Username, Link: h.cfg.VerifyLink + rawToken}
+	if err := h.sendEmail(ctx, user.Email, emails.Verification, h.emails.LocaleFromRequest(r), data); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "verification email queued", "user_id", user.ID.Hex())
+	return nil
+}
+
+// VerifyEmailHandler is opened from the verification email, it needs no login
+func (h *Handler) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	setNoCacheHeaders(w)
+
+	rawToken := r.URL.Query().Get("token")
+	tokenHash := utils.HashToken(model.TokenPurposeVerifyEmail, rawToken)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	token, err := h.repos.Tokens.Consume(ctx, model.TokenPurposeVerifyEmail, tokenHash)
+	if err != nil {
+		flash.AddError(w, r, "This verification link is invalid or has expired.")
+		http.Redirect(w, r, "/account/login", http.StatusSeeOther)
+		return
+	}
+
+	err = h.repos.Users.MarkEmailVerified(ctx, token.UserID)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to mark email verified", "user_id", token.UserID.Hex(), "error", err)
+		flash.AddError(w, r, "Your email could not be verified, ask for a new link.")
+		http.Redirect(w, r, "/account/login", http.StatusSeeOther)
+		return
+	}
+
+	if user, err := h.repos.Users.FindByID(ctx, token.UserID); err == nil {
+		h.publishUser(ctx, model.EventUserUpdated, user, "email_verified")
+	}
+	flash.AddSuccess(w, r, "Your email address is verified.")
+	http.Redirect(w, r, "/account/login", http.StatusSeeOther)
+}
+
+// ResendVerificationHandler sends a new verification link on behalf of an admin
+func (h *Handler) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	objID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		flash.AddError(w, r, "Invalid ID")
+		http.Redirect(w, r, "/home", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	user, err := h.repos.Users.FindByID(ctx, objID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		flash.AddError(w, r, "User not found")
+	case err != nil:
+		flash.AddError(w, r, "Error loading user")
+	case user.EmailVerified:
+		flash.AddInfo(w, r, user.Email+" is already verified.")
+	default:
+		if err := h.sendVerification(ctx, r, user); err != nil {
+			slog.ErrorContext(ctx, "failed to resend verification", "user_id", user.ID.Hex(), "error", err)
+			flash.AddError(w, r, "The verification email could not be sent.")
+		} else {
+			flash.AddSuccess(w, r, "Verification email sent to "+user.Email+".")
+		}
+	}
+	http.Redirect(w, r, "/home", http.StatusSeeOther)
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"go2/flash"
+	"go2/model"
+	"go2/render"
+	"go2/validator"
+	"go2/webhooks"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// deliveryLogSize is how many deliveries the webhooks page shows
+const deliveryLogSize = 100
+
+// WebhooksHandler lists the endpoints and the latest deliveries, of one endpoint with ?webhook=<id>
+func (h *Handler) WebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	setNoCacheHeaders(w)
+	h.renderWebhooks(w, r, http.StatusOK, model.Webhook{}, nil)
+}
+
+func (h *Handler) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	email, _ := GetSessionEmail(r)
+	_ = r.ParseForm()
+
+	webhook := model.Webhook{
+		URL:       strings.TrimSpace(r.FormValue("url")),
+		Events:    r.Form["events"],
+		CreatedBy: email,
+		CreatedAt: time.Now(),
+	}
+	if errs := validator.ValidateWebhook(webhook); errs.Any() {
+		h.renderWebhooks(w, r, http.StatusBadRequest, webhook, errs)
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		flash.AddError(w, r, "Webhook could not be saved")
+		http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+		return
+	}
+	webhook.Secret = secret
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.repos.Webhooks.Insert(ctx, webhook); err != nil {
+		flash.AddError(w, r, "Webhook could not be saved")
+	} else {
+		flash.AddSuccess(w, r, "Webhook added, copy its signing secret into the receiver")
+	}
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+func (h *Handler) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	objID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		flash.AddError(w, r, "Invalid ID")
+		http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.repos.Webhooks.Delete(ctx, objID); err != nil {
+		flash.AddError(w, r, "Webhook could not be deleted")
+	} else {
+		flash.AddSuccess(w, r, "Webhook deleted")
+	}
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+func (h *Handler) RedeliverHandler(w http.ResponseWriter, r *http.Request) {
+	objID, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		flash.AddError(w, r, "Invalid ID")
+		http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.repos.Deliveries.Redeliver(ctx, objID); err != nil {
+		flash.AddError(w, r, "Delivery could not be queued again, it may still be in the queue")
+	} else {
+		flash.AddSuccess(w, r, "Delivery queued again")
+	}
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+func (h *Handler) renderWebhooks(w http.ResponseWriter, r *http.Request, status int, form model.Webhook, errs validator.Errors) {
+	data := model.WebhooksPageData{
+		Title:  "Webhooks",
+		Events: webhooks.Events,
+		Form:   form,
+		Errors: errs,
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var filter primitive.ObjectID
+	if v := r.URL.Query().Get("webhook"); v != "" {
+		filter, _ = primitive.ObjectIDFromHex(v)
+	}
+
+	hooks, err := h.repos.Webhooks.List(ctx)
+	if err == nil {
+		data.Deliveries, err = h.repos.Deliveries.List(ctx, filter, deliveryLogSize)
+	}
+	if err != nil {
+		data.Error = "Error loading webhooks"
+	}
+	data.Webhooks = hooks
+	render.RenderTemplateWithStatus(w, r, status, "Webhooks.html", data)
+}
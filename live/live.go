@@ -0,0 +1,93 @@
+// Package live fans out change notifications to the browsers connected over Server-Sent Events.
+package live
+
+import (
+	"sync"
+)
+
+// Message tells a browser that a user changed
+type Message struct {
+	Type     string   `json:"type"` // one of the model.EventUser* names
+	ID       string   `json:"id"`
+	Username string   `json:"username,omitempty"`
+	Email    string   `json:"email,omitempty"`
+	Verified bool     `json:"email_verified"`
+	Mobile   string   `json:"mobile,omitempty"`
+	Fields   []string `json:"fields,omitempty"` // changed fields of an update, empty when unknown
+}
+
+// clientBuffer is how many messages may wait for a slow browser before it is disconnected
+const clientBuffer = 32
+
+// Broker keeps the connected clients. It only reaches the browsers connected to this
+// instance, with several instances it is fed by the change stream so every one sees every change.
+type Broker struct {
+	mu      sync.Mutex
+	clients map[chan Message]struct{}
+	closed  bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{clients: make(map[chan Message]struct{})}
+}
+
+// Subscribe registers a client. The channel is closed when the client falls behind or the
+// broker shuts down, the stream should then end so the browser reconnects.
+func (b *Broker) Subscribe() (<-chan Message, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Message, clientBuffer)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.clients[ch] = struct{}{}
+	return ch, func() { b.remove(ch) }
+}
+
+// Publish sends m to every client without waiting for any of them.
+func (b *Broker) Publish(m Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.clients {
+		select {
+		case ch <- m:
+		default:
+			// A client this far behind reloads anyway, dropping it keeps the others fast
+			delete(b.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// Clients returns the number of connected clients
+func (b *Broker) Clients() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.clients)
+}
+
+// Close disconnects every client and refuses new ones, used on shutdown because open
+// streams would otherwise keep the server from draining.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.clients {
+		delete(b.clients, ch)
+		close(ch)
+	}
+}
+
+func (b *Broker) remove(ch chan Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.clients[ch]; ok {
+		delete(b.clients, ch)
+		close(ch)
+	}
+}
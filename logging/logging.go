@@ -0,0 +1,107 @@
+// Package logging sets up the slog logger of the app. Every record carries the request ID from
+// its context and sensitive values (passwords, tokens, email addresses) are redacted.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"go2/config"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	tokenPattern = regexp.MustCompile(`(?i)(token=)[^&\s"]+`)
+
+	// attributes whose key contains one of these are never written
+	secretKeys = []string{"password", "token", "secret", "cookie", "authorization"}
+)
+
+// New builds the logger for the configured level and format
+func New(w io.Writer, cfg config.LogConfig) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("log level %q: %w", cfg.Level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+
+	var h slog.Handler
+	switch cfg.Format {
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("log format %q must be text or json", cfg.Format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// redact runs on every attribute, including the message
+func redact(_ []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, RedactString(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			return slog.String(a.Key, RedactString(v.Error()))
+		case []string:
+			out := make([]string, len(v))
+			for i, s := range v {
+				out[i] = RedactString(s)
+			}
+			return slog.Any(a.Key, out)
+		}
+	}
+	return a
+}
+
+// RedactString masks email addresses and token query parameters inside free text
+func RedactString(s string) string {
+	s = tokenPattern.ReplaceAllString(s, "${1}"+redacted)
+	return emailPattern.ReplaceAllStringFunc(s, maskEmail)
+}
+
+// maskEmail keeps the first letter and the domain, enough to tell accounts apart while debugging
+func maskEmail(email string) string {
+	at := strings.LastIndexByte(email, '@')
+	if at <= 0 {
+		return redacted
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+// contextHandler adds the request ID stored in the context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
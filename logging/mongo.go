@@ -0,0 +1,23 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// CommandMonitor logs every MongoDB command at debug level. The driver passes the operation
+// context, so the line carries the request ID of the handler that ran the command.
+func CommandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			slog.DebugContext(ctx, "mongo command",
+				"command", e.CommandName, "database", e.DatabaseName, "duration", e.Duration)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			slog.WarnContext(ctx, "mongo command failed",
+				"command", e.CommandName, "database", e.DatabaseName, "duration", e.Duration, "error", e.Failure)
+		},
+	}
+}
@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ConsoleMailer prints a short summary and the plain text body, handy when running locally.
+type ConsoleMailer struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewConsoleMailer(out io.Writer) *ConsoleMailer {
+	return &ConsoleMailer{out: out}
+}
+
+func (c *ConsoleMailer) Send(ctx context.Context, msg Message) error {
+	if _, err := msg.Bytes(); err != nil {
+		return err
+	}
+	body := msg.Text
+	if body == "" {
+		body = msg.HTML
+	}
+
+	for _, a := range msg.Attachments {
+		body += fmt.Sprintf("\n[attachment %s, %d bytes]", a.Filename, len(a.Data))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := fmt.Fprintf(c.out, "----- mail -----\nFrom: %s\nTo: %s\nSubject: %s\n\n%s\n----------------\n",
+		msg.From, strings.Join(msg.To, ", "), msg.Subject, body)
+	return err
+}
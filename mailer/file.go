@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer writes every message as an .eml file in a maildir style layout (tmp, new, cur),
+// so development mail can be opened with any mail client.
+type FileMailer struct {
+	dir     string
+	counter atomic.Uint64
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("mailer: creating %s: %w", dir, err)
+		}
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+func (f *FileMailer) Send(ctx context.Context, msg Message) error {
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	// Write into tmp first and rename, readers of new never see a half written file
+	name := fmt.Sprintf("%d.%d_%d.eml", time.Now().UnixNano(), os.Getpid(), f.counter.Add(1))
+	tmpPath := filepath.Join(f.dir, "tmp", name)
+	if err := os.WriteFile(tmpPath, body, 0o644); err != nil {
+		return fmt.Errorf("mailer: writing %s: %w", tmpPath, err)
+	}
+	return os.Rename(tmpPath, filepath.Join(f.dir, "new", name))
+}
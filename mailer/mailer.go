@@ -0,0 +1,134 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go2/config"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// Mailer delivers a single email. Every outgoing message in the app goes through one.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Message is a transport independent email. At least one of HTML and Text must be set,
+// when both are set the message is sent as multipart/alternative.
+type Message struct {
+	From        string
+	To          []string
+	Subject     string
+	HTML        string
+	Text        string
+	Attachments []Attachment
+}
+
+// Attachment is a file sent along with the message
+type Attachment struct {
+	Filename    string
+	ContentType string // detected from the file extension when empty
+	Data        []byte
+}
+
+// TLS modes for the SMTP backend
+const (
+	TLSStartTLS = "starttls" // plain connection upgraded with STARTTLS, usually port 587
+	TLSImplicit = "tls"      // TLS from the first byte, usually port 465
+	TLSNone     = "none"     // local relays and test servers only
+)
+
+// New builds the backend selected in the config.
+func New(cfg config.MailConfig) (Mailer, error) {
+	var m Mailer
+	switch strings.ToLower(cfg.Backend) {
+	case "smtp":
+		if cfg.SMTP.Host == "" {
+			return nil, fmt.Errorf("mailer: SMTP host is required")
+		}
+		m = NewSMTPMailer(cfg.SMTP)
+	case "file":
+		fm, err := NewFileMailer(cfg.Dir)
+		if err != nil {
+			return nil, err
+		}
+		m = fm
+	case "console":
+		m = NewConsoleMailer(os.Stdout)
+	case "memory":
+		m = NewMemoryMailer()
+	default:
+		return nil, fmt.Errorf("mailer: unknown backend %q", cfg.Backend)
+	}
+	return WithDefaultFrom(m, cfg.From), nil
+}
+
+// WithDefaultFrom fills in the sender for messages that do not set one.
+func WithDefaultFrom(m Mailer, from string) Mailer {
+	return defaultFrom{next: m, from: from}
+}
+
+type defaultFrom struct {
+	next Mailer
+	from string
+}
+
+func (d defaultFrom) Send(ctx context.Context, msg Message) error {
+	if msg.From == "" {
+		msg.From = d.from
+	}
+	return d.next.Send(ctx, msg)
+}
+
+// Bytes renders the message in RFC 5322 format, as it goes over the wire.
+func (msg Message) Bytes() ([]byte, error) {
+	if len(msg.To) == 0 {
+		return nil, fmt.Errorf("mailer: message has no recipients")
+	}
+	if msg.HTML == "" && msg.Text == "" {
+		return nil, fmt.Errorf("mailer: message has no body")
+	}
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", msg.From)
+	m.SetHeader("To", msg.To...)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetDateHeader("Date", time.Now())
+
+	// The last alternative is the preferred one, so plain text goes first
+	switch {
+	case msg.Text != "" && msg.HTML != "":
+		m.SetBody("text/plain", msg.Text)
+		m.AddAlternative("text/html", msg.HTML)
+	case msg.HTML != "":
+		m.SetBody("text/html", msg.HTML)
+	default:
+		m.SetBody("text/plain", msg.Text)
+	}
+
+	for _, a := range msg.Attachments {
+		if a.Filename == "" {
+			return nil, fmt.Errorf("mailer: attachment has no file name")
+		}
+		data := a.Data
+		settings := []gomail.FileSetting{gomail.SetCopyFunc(func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		})}
+		if a.ContentType != "" {
+			settings = append(settings, gomail.SetHeader(map[string][]string{"Content-Type": {a.ContentType}}))
+		}
+		m.Attach(a.Filename, settings...)
+	}
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("mailer: writing message: %w", err)
+	}
+	return buf.Bytes(), nil
+}
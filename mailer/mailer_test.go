@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestEnvelopeAddress(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"admin@example.com", "admin@example.com"},
+		{"Go2 App <noreply@example.com>", "noreply@example.com"},
+		{`"Smith, Jane" <jane@example.com>`, "jane@example.com"},
+	}
+	for _, tt := range tests {
+		got, err := envelopeAddress(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("envelopeAddress(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "not an address", "a@example.com\r\nRCPT TO:<b@example.com>"} {
+		if got, err := envelopeAddress(in); err == nil {
+			t.Errorf("envelopeAddress(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	mem := NewMemoryMailer()
+	m := WithDefaultFrom(mem, "Go2 App <noreply@example.com>")
+	ctx := context.Background()
+
+	if err := m.Send(ctx, Message{To: []string{"jane@example.com"}, Subject: "Hi", Text: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(ctx, Message{Subject: "Nobody", Text: "Hello"}); err == nil {
+		t.Error("message without recipients accepted")
+	}
+	if err := m.Send(ctx, Message{To: []string{"jane@example.com"}, Subject: "Empty"}); err == nil {
+		t.Error("message without a body accepted")
+	}
+
+	sent := mem.Messages()
+	if len(sent) != 1 || sent[0].From != "Go2 App <noreply@example.com>" {
+		t.Fatalf("sent %+v", sent)
+	}
+	raw, err := sent[0].Bytes()
+	if err != nil || !strings.Contains(string(raw), "Subject: Hi") {
+		t.Errorf("rendered message %q, %v", raw, err)
+	}
+
+	mem.Reset()
+	if len(mem.Messages()) != 0 {
+		t.Error("Reset kept messages")
+	}
+}
@@ -0,0 +1,122 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"go2/config"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPMailer sends mail through any SMTP relay, the TLS mode decides how the connection is secured.
+type SMTPMailer struct {
+	cfg config.SMTPConfig
+}
+
+func NewSMTPMailer(cfg config.SMTPConfig) *SMTPMailer {
+	if cfg.TLSMode == "" {
+		cfg.TLSMode = TLSStartTLS
+	}
+	return &SMTPMailer{cfg: cfg}
+}
+
+func (s *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	client, err := s.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("mailer: connecting to %s: %w", s.cfg.Host, err)
+	}
+	defer client.Close()
+
+	if s.cfg.TLSMode == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("mailer: %s does not support STARTTLS", s.cfg.Host)
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+			return fmt.Errorf("mailer: STARTTLS: %w", err)
+		}
+	}
+
+	if s.cfg.Username != "" {
+		auth := smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("mailer: auth: %w", err)
+		}
+	}
+
+	// The envelope takes the bare address, "Name <addr>" stays in the headers only
+	from, err := envelopeAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("mailer: sender %q: %w", msg.From, err)
+	}
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("mailer: MAIL FROM: %w", err)
+	}
+	for _, to := range msg.To {
+		rcpt, err := envelopeAddress(to)
+		if err != nil {
+			return fmt.Errorf("mailer: recipient %q: %w", to, err)
+		}
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("mailer: RCPT TO %s: %w", rcpt, err)
+		}
+	}
+
+	wc, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("mailer: DATA: %w", err)
+	}
+	if _, err := wc.Write(body); err != nil {
+		wc.Close()
+		return fmt.Errorf("mailer: writing body: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("mailer: finishing DATA: %w", err)
+	}
+	return client.Quit()
+}
+
+func envelopeAddress(addr string) (string, error) {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return "", err
+	}
+	return parsed.Address, nil
+}
+
+func (s *SMTPMailer) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if s.cfg.TLSMode == TLSImplicit {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: s.cfg.Host}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Bound the whole conversation by the context deadline
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
@@ -0,0 +1,122 @@
+// Package metrics holds the Prometheus collectors of the app and the /metrics handler.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// Registry is separate from the default one so only our collectors and the runtime ones are exported
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route pattern, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route pattern, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	mongoDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongodb_command_duration_seconds",
+		Help:    "MongoDB command latency by command name and outcome.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command", "status"})
+
+	// LoginAttempts counts admin logins, result is "success" or "failure"
+	LoginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_login_attempts_total",
+		Help: "Login attempts by result.",
+	}, []string{"result"})
+
+	// ResetEmailsQueued counts password reset emails put in the outbox, not their delivery
+	ResetEmailsQueued = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "auth_reset_emails_queued_total",
+		Help: "Password reset emails queued for delivery.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, mongoDuration, LoginAttempts, ResetEmailsQueued,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterSessionGauge exports the number of active sessions, read from the store on every scrape
+func RegisterSessionGauge(count func() int) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "sessions_active",
+		Help: "Sessions currently held in the session store.",
+	}, func() float64 { return float64(count()) }))
+}
+
+// RegisterStreamGauge exports the number of open Server-Sent Events streams
+func RegisterStreamGauge(count func() int) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "event_streams_open",
+		Help: "Server-Sent Events streams currently connected to this instance.",
+	}, func() float64 { return float64(count()) }))
+}
+
+// Middleware records count and latency of every request. The route label is the ServeMux pattern
+// that matched, so unknown paths do not create new series.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		labels := prometheus.Labels{"route": route, "method": r.Method, "status": strconv.Itoa(rec.status)}
+		httpRequests.With(labels).Inc()
+		httpDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// CommandMonitor times every MongoDB command, attach it to the client options
+func CommandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			mongoDuration.WithLabelValues(e.CommandName, "ok").Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			mongoDuration.WithLabelValues(e.CommandName, "error").Observe(e.Duration.Seconds())
+		},
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
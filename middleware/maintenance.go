@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"go2/render"
+	"net/http"
+	"strings"
+)
+
+// Maintenance answers every page with the maintenance page while enabled reports true.
+// Probes, metrics and static files keep working so the orchestrator and the page itself do.
+func Maintenance(enabled func() bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !enabled() || maintenanceExempt(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Retry-After", "300")
+			render.Error(w, r, http.StatusServiceUnavailable, "")
+		})
+	}
+}
+
+func maintenanceExempt(path string) bool {
+	switch path {
+	case "/healthz", "/readyz", "/version", "/metrics":
+		return true
+	}
+	return strings.HasPrefix(path, "/static/")
+}
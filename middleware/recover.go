@@ -0,0 +1,30 @@
+// Package middleware holds the middleware shared by every route group.
+package middleware
+
+import (
+	"go2/render"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover turns a panic in a handler into the 500 error page instead of a dropped connection.
+// The stack is logged together with the request ID shown on the page.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// ErrAbortHandler is the documented way to abort a response, let net/http handle it
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			slog.ErrorContext(r.Context(), "panic while serving request",
+				"method", r.Method, "path", r.URL.Path, "panic", err, "stack", string(debug.Stack()))
+			render.Error(w, r, http.StatusInternalServerError, "")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
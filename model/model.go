@@ -1,32 +1,175 @@
 package model
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"html/template"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type User struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty"`
-	Username    string             `bson:"username"`
-	Email       string             `bson:"email"`
-	Password    string             `bson:"password"`
-	Mobile      string             `bson:"mobile"`
-	Address     string             `bson:"address"`
-	Gender      string             `bson:"gender"`
-	Sports      string             `bson:"sports"`
-	DOB         string             `bson:"dob"`
-	Country     string             `bson:"country"`
-	Image       []byte             `bson:"image,omitempty"`
-	ImageBase64 string
+	ID              primitive.ObjectID `bson:"_id,omitempty"`
+	Username        string             `bson:"username"`
+	Email           string             `bson:"email"`
+	EmailVerified   bool               `bson:"email_verified"` // false until the verification link is opened, also for users older than the flag
+	Password        string             `bson:"password"`
+	PasswordHistory []string           `bson:"password_history,omitempty"` // earlier hashes, newest first
+	Mobile          string             `bson:"mobile"`
+	Address         string             `bson:"address"`
+	Gender          string             `bson:"gender"`
+	Sports          string             `bson:"sports"`
+	DOB             string             `bson:"dob"`
+	Country         string             `bson:"country"`
+	Image           []byte             `bson:"image,omitempty"`
+	ImageBase64     string
+}
+
+// Values of the verification filter of the user listing, empty lists everyone
+const (
+	FilterVerified   = "verified"
+	FilterUnverified = "unverified"
+)
+
+// UserFilter narrows the user listing
+type UserFilter struct {
+	Verified string // "", FilterVerified or FilterUnverified
 }
 
 type Admin struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty"`
-	Email    string             `bson:"email"`
-	Password string             `bson:"password"`
+	ID              primitive.ObjectID `bson:"_id,omitempty"`
+	Email           string             `bson:"email"`
+	Password        string             `bson:"password"`
+	PasswordHistory []string           `bson:"password_history,omitempty"` // earlier hashes, newest first
+}
+
+// Token purposes, a token hash only matches the purpose it was issued for
+const (
+	TokenPurposeAdminReset  = "admin_password_reset"
+	TokenPurposeUserReset   = "user_password_reset"
+	TokenPurposeInvite      = "invite"
+	TokenPurposeVerifyEmail = "email_verification"
+)
+
+type Token struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	Purpose   string             `bson:"purpose"`
+	TokenHash string             `bson:"token"`
+	ExpiresAt time.Time          `bson:"expires_at"` // TTL index removes the document after this
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+// Outbox states, a message is retried while pending and parked as dead after the last attempt
+const (
+	OutboxPending = "pending"
+	OutboxSending = "sending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+)
+
+type OutboxEmail struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	From          string             `bson:"from,omitempty"`
+	To            []string           `bson:"to"`
+	Subject       string             `bson:"subject"`
+	HTML          string             `bson:"html,omitempty"`
+	Text          string             `bson:"text,omitempty"`
+	Attachments   []Attachment       `bson:"attachments,omitempty"`
+	Status        string             `bson:"status"`
+	Attempts      int                `bson:"attempts"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at"`
+	LockedUntil   time.Time          `bson:"locked_until,omitempty"` // lease held by the worker while sending
+	LastError     string             `bson:"last_error,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at"`
+	SentAt        time.Time          `bson:"sent_at,omitempty"`
+	FinishedAt    time.Time          `bson:"finished_at,omitempty"` // when it was sent or given up, the TTL index removes it later
+}
+
+// Report kinds and how often a scheduled report runs
+const (
+	ReportNewUsersByCountry = "new_users_by_country"
+	ReportUserExport        = "user_export"
+
+	FrequencyDaily  = "daily"
+	FrequencyWeekly = "weekly"
+)
+
+// ReportSchedule is a report emailed to Recipients as a CSV attachment, or as a download link
+// when the file is too large. Times are in UTC, a weekly report runs on Weekday at Hour, a
+// daily one every day at Hour.
+type ReportSchedule struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Name        string             `bson:"name"`
+	Kind        string             `bson:"kind"`
+	Frequency   string             `bson:"frequency"`
+	Weekday     time.Weekday       `bson:"weekday"`
+	Hour        int                `bson:"hour"`
+	Recipients  []string           `bson:"recipients"`
+	NextRunAt   time.Time          `bson:"next_run_at"`
+	LastRunAt   time.Time          `bson:"last_run_at,omitempty"`
+	LastError   string             `bson:"last_error,omitempty"`
+	LockedUntil time.Time          `bson:"locked_until,omitempty"` // lease held by the instance running it
+	LockedBy    string             `bson:"locked_by,omitempty"`
+	CreatedBy   string             `bson:"created_by"`
+	CreatedAt   time.Time          `bson:"created_at"`
 }
 
-type PasswordResetToken struct {
-	UserID      primitive.ObjectID `bson:"user_id"`
-	TokenHash   string             `bson:"token"`
-	TokenExpiry int64              `bson:"token_expiry"`
+// ReportFile is a generated report too large to attach, recipients download it instead
+type ReportFile struct {
+	ID        primitive.ObjectID
+	Filename  string
+	Data      []byte
+	CreatedAt time.Time
+}
+
+// Webhook events, an endpoint subscribes to one or more of them
+const (
+	EventUserCreated = "user.created"
+	EventUserUpdated = "user.updated"
+	EventUserDeleted = "user.deleted"
+	EventAdminLogin  = "admin.login"
+)
+
+// Webhook is an endpoint that receives events as signed JSON POST requests
+type Webhook struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	URL       string             `bson:"url"`
+	Events    []string           `bson:"events"`
+	Secret    string             `bson:"secret"` // HMAC-SHA256 key, shared with the receiver
+	CreatedBy string             `bson:"created_by"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+// Webhook delivery states, retried like the email outbox
+const (
+	DeliveryPending   = "pending"
+	DeliverySending   = "sending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is one event sent to one endpoint, it doubles as the delivery log
+type WebhookDelivery struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	WebhookID     primitive.ObjectID `bson:"webhook_id"`
+	URL           string             `bson:"url"`
+	Event         string             `bson:"event"`
+	Payload       string             `bson:"payload"` // JSON body, signed as is
+	Status        string             `bson:"status"`
+	Attempts      int                `bson:"attempts"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at"`
+	LockedUntil   time.Time          `bson:"locked_until,omitempty"`
+	ResponseCode  int                `bson:"response_code,omitempty"` // of the last attempt, 0 when no response came back
+	LastError     string             `bson:"last_error,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at"`
+	DeliveredAt   time.Time          `bson:"delivered_at,omitempty"`
+}
+
+// Attachment is a file stored with a queued email
+type Attachment struct {
+	Filename    string `bson:"filename"`
+	ContentType string `bson:"content_type,omitempty"`
+	Data        []byte `bson:"data"`
 }
 
 // this is used for html queries not for mongodb so, bson is not required!
@@ -35,6 +178,7 @@ type RegisterPageData struct {
 	Countries []string
 	SportsMap map[string]bool
 	Error     string
+	Errors    map[string]string // field name -> message shown next to the field
 	Title     string
 }
 
@@ -46,6 +190,7 @@ type HomePageData struct {
 	Title      string
 	SortField  string
 	SortOrder  string
+	Verified   string // verification filter, see FilterVerified
 	AdminName  string
 }
 
@@ -55,6 +200,7 @@ type EditPageData struct {
 	Countries []string
 	SportsMap map[string]bool
 	Error     string
+	Errors    map[string]string
 }
 
 type EmailData struct {
@@ -72,9 +218,113 @@ type ForgotPageData struct {
 	Error string
 }
 
+type PasswordPageData struct {
+	Title  string
+	Error  string
+	Errors map[string]string // field name -> message shown next to the field
+}
+
 type ResetPageData struct {
 	Error string
 	Token string
 	Title string
 	Info  string
 }
+
+type EmailsPageData struct {
+	Title  string
+	Emails []OutboxEmail
+	Error  string
+}
+
+type EmailPreviewPageData struct {
+	Title   string
+	Names   []string
+	Locales []string
+	Name    string
+	Locale  string
+	Subject string
+	HTML    string
+	Text    string
+	Error   string
+}
+
+type ErrorPageData struct {
+	Title     string
+	Status    int
+	Heading   string
+	Message   string
+	RequestID string // shown so users can quote it when reporting the problem
+}
+
+// Registration intervals of the dashboard
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// StatsFilter limits the statistics to users created in [From, To), taken from the _id time
+type StatsFilter struct {
+	From     time.Time
+	To       time.Time
+	Interval string
+}
+
+type Count struct {
+	Label string
+	Count int64
+}
+
+// PeriodCount is the number of registrations in the period starting at Start
+type PeriodCount struct {
+	Start time.Time
+	Count int64
+}
+
+type UserStats struct {
+	Total         int64
+	ByCountry     []Count // sorted by count, highest first
+	ByGender      []Count
+	BySport       []Count
+	ByAgeBand     []Count // in age order, see analytics.AgeBands
+	Registrations []PeriodCount
+}
+
+type ReportsPageData struct {
+	Title       string
+	Schedules   []ReportSchedule
+	Kinds       []string
+	KindNames   map[string]string
+	Frequencies []string
+	Weekdays    []time.Weekday
+	Form        ReportSchedule
+	Recipients  string            // comma separated, as typed in the form
+	Errors      map[string]string // field name -> message shown next to the field
+	Error       string
+}
+
+type WebhooksPageData struct {
+	Title      string
+	Webhooks   []Webhook
+	Deliveries []WebhookDelivery
+	Events     []string
+	Form       Webhook
+	Errors     map[string]string // field name -> message shown next to the field
+	Error      string
+}
+
+type DashboardPageData struct {
+	Title     string
+	From      string
+	To        string
+	Interval  string
+	Intervals []string
+	Total     int64
+	Country   template.HTML // server rendered SVG charts
+	Gender    template.HTML
+	Sports    template.HTML
+	AgeBands  template.HTML
+	Growth    template.HTML
+	Error     string
+}
@@ -8,15 +8,16 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func GetPaginatedUsers(ctx context.Context, page, limit int, sortField, sortOrder string) ([]model.User, int64, error) {
+func (r *userRepository) List(ctx context.Context, filter model.UserFilter, page, limit int, sortField, sortOrder string) ([]model.User, int64, error) {
 	offset := (page - 1) * limit
+	query := userQuery(filter)
 
 	findOptions := options.Find().
 		SetSkip(int64(offset)).
 		SetLimit(int64(limit)).
 		SetSort(bson.D{{Key: sortField, Value: getSortOrderValue(sortOrder)}})
 
-	cursor, err := GetUserCollection().Find(ctx, bson.M{}, findOptions)
+	cursor, err := r.coll.Find(ctx, query, findOptions)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -27,7 +28,7 @@ func GetPaginatedUsers(ctx context.Context, page, limit int, sortField, sortOrde
 		return nil, 0, err
 	}
 
-	total, err := GetUserCollection().CountDocuments(ctx, bson.M{})
+	total, err := r.coll.CountDocuments(ctx, query)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -35,6 +36,17 @@ func GetPaginatedUsers(ctx context.Context, page, limit int, sortField, sortOrde
 	return users, total, nil
 }
 
+// userQuery turns the listing filter into a query, users without the flag count as unverified
+func userQuery(filter model.UserFilter) bson.M {
+	switch filter.Verified {
+	case model.FilterVerified:
+		return bson.M{"email_verified": true}
+	case model.FilterUnverified:
+		return bson.M{"email_verified": bson.M{"$ne": true}}
+	}
+	return bson.M{}
+}
+
 func getSortOrderValue(order string) int {
 	if order == "asc" {
 		return 1
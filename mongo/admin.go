@@ -3,37 +3,63 @@ package mongo
 import (
 	"context"
 	"go2/model"
-	"os"
-	"time"
+	"go2/repository"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func getDBName() string {
-	return os.Getenv("MONGO_DB_NAME")
+type adminRepository struct {
+	coll *mongo.Collection
 }
 
-func GetAdminByEmail(ctx context.Context, email string) (model.Admin, error) {
+func (r *adminRepository) FindByID(ctx context.Context, id primitive.ObjectID) (model.Admin, error) {
 	var admin model.Admin
-	collection := GetCollection(getDBName(), "admins")
-	err := collection.FindOne(ctx, bson.M{"email": email}).Decode(&admin)
-	return admin, err
+	err := r.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&admin)
+	return admin, mapError(err)
 }
 
-func CheckAdminExists(email string) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (r *adminRepository) FindByEmail(ctx context.Context, email string) (model.Admin, error) {
+	var admin model.Admin
+	err := r.coll.FindOne(ctx, bson.M{"email": email}).Decode(&admin)
+	return admin, mapError(err)
+}
+
+func (r *adminRepository) UpdatePassword(ctx context.Context, adminID primitive.ObjectID, hashedPassword string, history int) error {
+	res, err := r.coll.UpdateByID(ctx, adminID, passwordUpdate(hashedPassword, history))
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
 
-	collection := GetCollection(getDBName(), "admins")
-	count, err := collection.CountDocuments(ctx, bson.M{"email": email})
-	return count > 0, err
+func (r *adminRepository) RehashPassword(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	res, err := r.coll.UpdateOne(ctx, bson.M{"_id": id, "password": oldHash}, bson.M{"$set": bson.M{"password": newHash}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
 }
 
-func UpdateAdminPassword(ctx context.Context, adminID primitive.ObjectID, hashedPassword string) error {
-	_, err := GetCollection(getDBName(), "admins").
-		UpdateByID(ctx, adminID, bson.M{
-			"$set": bson.M{"password": hashedPassword},
-		})
-	return err
+// passwordUpdate sets a new password and keeps the replaced one in password_history. It is an
+// update pipeline so "$password" still refers to the stored, old hash. Every hash starts with
+// "$" and would be read as a field path there, so the new one goes in as a $literal.
+func passwordUpdate(hashedPassword string, history int) mongo.Pipeline {
+	var kept any = bson.A{}
+	if history > 0 {
+		kept = bson.M{"$slice": bson.A{
+			bson.M{"$concatArrays": bson.A{bson.A{"$password"}, bson.M{"$ifNull": bson.A{"$password_history", bson.A{}}}}},
+			history,
+		}}
+	}
+	return mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"password_history": kept, "password": bson.M{"$literal": hashedPassword}}}},
+	}
 }
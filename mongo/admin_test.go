@@ -0,0 +1,65 @@
+package mongo
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPasswordUpdateLiteralHash(t *testing.T) {
+	hashes := []string{
+		"$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy",
+		"$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHRzYWx0$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5",
+	}
+	for _, hash := range hashes {
+		for _, history := range []int{0, 5} {
+			pipeline := passwordUpdate(hash, history)
+			if len(pipeline) != 1 {
+				t.Fatalf("want one stage, got %d", len(pipeline))
+			}
+			stage := pipeline[0]
+			if stage[0].Key != "$set" {
+				t.Fatalf("want a $set stage, got %s", stage[0].Key)
+			}
+
+			// Round trip through BSON, as the driver sends it
+			raw, err := bson.Marshal(stage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded struct {
+				Set struct {
+					Password bson.M `bson:"password"`
+					History  any    `bson:"password_history"`
+				} `bson:"$set"`
+			}
+			if err := bson.Unmarshal(raw, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if got := decoded.Set.Password["$literal"]; got != hash {
+				t.Errorf("history %d: password = %v, want $literal %q", history, decoded.Set.Password, hash)
+			}
+			if decoded.Set.History == nil {
+				t.Errorf("history %d: password_history is not set", history)
+			}
+		}
+	}
+}
+
+func TestPasswordUpdateKeepsOldHash(t *testing.T) {
+	stage := passwordUpdate("$2a$10$x", 3)[0]
+	set := stage[0].Value.(bson.M)
+
+	slice, ok := set["password_history"].(bson.M)["$slice"].(bson.A)
+	if !ok || len(slice) != 2 || slice[1] != 3 {
+		t.Fatalf("password_history = %v, want a $slice to 3", set["password_history"])
+	}
+	concat := slice[0].(bson.M)["$concatArrays"].(bson.A)
+	if first := concat[0].(bson.A); first[0] != "$password" {
+		t.Errorf("the old hash should come first, got %v", first)
+	}
+
+	if kept := passwordUpdate("$2a$10$x", 0)[0][0].Value.(bson.M)["password_history"]; len(kept.(bson.A)) != 0 {
+		t.Errorf("history 0 should clear password_history, got %v", kept)
+	}
+}
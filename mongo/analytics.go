@@ -0,0 +1,168 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"go2/analytics"
+	"go2/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type analyticsRepository struct {
+	users *mongo.Collection
+}
+
+type statsBucket struct {
+	ID    bson.RawValue `bson:"_id"`
+	Count int64         `bson:"n"`
+}
+
+// UserStats runs one aggregation with a $facet per chart. The creation time comes from the _id,
+// so the date range is an _id range and uses the primary index. $dateTrunc needs MongoDB 5.0.
+func (r *analyticsRepository) UserStats(ctx context.Context, f model.StatsFilter) (model.UserStats, error) {
+	now := time.Now().UTC()
+	count := bson.M{"$sum": 1}
+
+	byField := func(field string) bson.A {
+		return bson.A{
+			bson.M{"$group": bson.M{"_id": "$" + field, "n": count}},
+		}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"_id": bson.M{
+			"$gte": primitive.NewObjectIDFromTimestamp(f.From),
+			"$lt":  primitive.NewObjectIDFromTimestamp(f.To),
+		}}}},
+		{{Key: "$facet", Value: bson.M{
+			"total":   bson.A{bson.M{"$count": "n"}},
+			"country": byField("country"),
+			"gender":  byField("gender"),
+			"sport": bson.A{
+				bson.M{"$project": bson.M{"sport": bson.M{"$split": bson.A{bson.M{"$ifNull": bson.A{"$sports", ""}}, ","}}}},
+				bson.M{"$unwind": "$sport"},
+				bson.M{"$project": bson.M{"sport": bson.M{"$trim": bson.M{"input": "$sport"}}}},
+				bson.M{"$match": bson.M{"sport": bson.M{"$ne": ""}}},
+				bson.M{"$group": bson.M{"_id": "$sport", "n": count}},
+			},
+			"age": bson.A{
+				bson.M{"$project": bson.M{"dob": bson.M{"$dateFromString": bson.M{
+					"dateString": "$dob", "format": "%Y-%m-%d", "onError": nil, "onNull": nil,
+				}}}},
+				bson.M{"$project": bson.M{"age": ageExpression(now)}},
+				bson.M{"$bucket": bson.M{
+					"groupBy":    "$age",
+					"boundaries": ageBoundaries(),
+					"default":    analytics.UnknownAge,
+					"output":     bson.M{"n": count},
+				}},
+			},
+			"registrations": bson.A{
+				bson.M{"$group": bson.M{
+					"_id": bson.M{"$dateTrunc": bson.M{
+						"date": bson.M{"$toDate": "$_id"}, "unit": f.Interval, "startOfWeek": "monday", "timezone": "UTC",
+					}},
+					"n": count,
+				}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+		}}},
+	}
+
+	cursor, err := r.users.Aggregate(ctx, pipeline)
+	if err != nil {
+		return model.UserStats{}, fmt.Errorf("user statistics: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Total         []statsBucket `bson:"total"`
+		Country       []statsBucket `bson:"country"`
+		Gender        []statsBucket `bson:"gender"`
+		Sport         []statsBucket `bson:"sport"`
+		Age           []statsBucket `bson:"age"`
+		Registrations []statsBucket `bson:"registrations"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return model.UserStats{}, fmt.Errorf("user statistics: %w", err)
+	}
+	if len(result) == 0 {
+		return model.UserStats{}, nil
+	}
+	facets := result[0]
+
+	stats := model.UserStats{
+		ByCountry: labelledCounts(facets.Country),
+		ByGender:  labelledCounts(facets.Gender),
+		BySport:   labelledCounts(facets.Sport),
+	}
+	if len(facets.Total) > 0 {
+		stats.Total = facets.Total[0].Count
+	}
+
+	// $bucket names a band by its lower boundary
+	ages := make(map[string]int64)
+	for _, b := range facets.Age {
+		label := analytics.UnknownAge
+		if lower, ok := b.ID.AsInt64OK(); ok {
+			for _, band := range analytics.AgeBands {
+				if int64(band.Min) == lower {
+					label = band.Label
+				}
+			}
+		}
+		ages[label] += b.Count
+	}
+	stats.ByAgeBand = analytics.OrderAgeBands(ages)
+
+	for _, b := range facets.Registrations {
+		if start, ok := b.ID.DateTimeOK(); ok {
+			stats.Registrations = append(stats.Registrations, model.PeriodCount{
+				Start: time.UnixMilli(start).UTC(),
+				Count: b.Count,
+			})
+		}
+	}
+	return stats, nil
+}
+
+// ageExpression computes full years between dob and now, -1 when dob is missing or invalid
+func ageExpression(now time.Time) bson.M {
+	birthdayPassed := bson.M{"$lte": bson.A{
+		bson.M{"$add": bson.A{bson.M{"$multiply": bson.A{bson.M{"$month": "$dob"}, 100}}, bson.M{"$dayOfMonth": "$dob"}}},
+		int(now.Month())*100 + now.Day(),
+	}}
+	return bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{"$dob", nil}},
+		-1,
+		bson.M{"$subtract": bson.A{
+			bson.M{"$subtract": bson.A{now.Year(), bson.M{"$year": "$dob"}}},
+			bson.M{"$cond": bson.A{birthdayPassed, 0, 1}},
+		}},
+	}}
+}
+
+func ageBoundaries() bson.A {
+	boundaries := bson.A{}
+	for _, band := range analytics.AgeBands {
+		boundaries = append(boundaries, band.Min)
+	}
+	return append(boundaries, analytics.AgeBands[len(analytics.AgeBands)-1].Max)
+}
+
+// labelledCounts turns $group results into sorted counts
+func labelledCounts(buckets []statsBucket) []model.Count {
+	byLabel := make(map[string]int64, len(buckets))
+	for _, b := range buckets {
+		label, ok := b.ID.StringValueOK()
+		if !ok || label == "" {
+			label = analytics.NotSet // null and "" end up in the same bar
+		}
+		byLabel[label] += b.Count
+	}
+	return analytics.Counts(byLabel)
+}
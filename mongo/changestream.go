@@ -0,0 +1,148 @@
+package mongo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go2/events"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// streamName identifies the change stream in the resume token collection
+const streamName = "users_admins"
+
+// Error codes after which the saved resume token cannot be used again
+const (
+	codeInvalidResumeToken      = 260
+	codeChangeStreamHistoryLost = 286
+)
+
+type changeEvent struct {
+	ID            bson.Raw `bson:"_id"`
+	OperationType string   `bson:"operationType"`
+	NS            struct {
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument      bson.Raw `bson:"fullDocument"`
+	UpdateDescription struct {
+		UpdatedFields bson.Raw `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+	ClusterTime primitive.Timestamp `bson:"clusterTime"`
+}
+
+type resumeToken struct {
+	ID        string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// WatchChanges publishes every change to users and admins on bus until ctx is cancelled.
+// The resume token is saved after each event, so after a restart the stream continues
+// where it stopped. Lost connections are retried with a growing delay.
+func (s *Store) WatchChanges(ctx context.Context, bus *events.Bus) {
+	delay := time.Second
+	for {
+		started := time.Now()
+		err := s.watch(ctx, bus)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > time.Minute {
+			delay = time.Second // the stream was healthy for a while
+		}
+		slog.WarnContext(ctx, "change stream stopped, reconnecting", "error", err, "retry_in", delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, time.Minute)
+	}
+}
+
+func (s *Store) watch(ctx context.Context, bus *events.Bus) error {
+	tokens := s.DB.Collection(resumeTokensCollection)
+
+	var saved resumeToken
+	err := tokens.FindOne(ctx, bson.M{"_id": streamName}).Decode(&saved)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("loading resume token: %w", err)
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{
+		"ns.coll":       bson.M{"$in": bson.A{usersCollection, adminsCollection}},
+		"operationType": bson.M{"$in": bson.A{events.Insert, events.Update, events.Replace, events.Delete}},
+	}}}}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if saved.Token != nil {
+		opts.SetResumeAfter(saved.Token)
+	}
+
+	stream, err := s.DB.Watch(ctx, pipeline, opts)
+	if err != nil {
+		var se mongo.ServerError
+		if saved.Token != nil && errors.As(err, &se) &&
+			(se.HasErrorCode(codeChangeStreamHistoryLost) || se.HasErrorCode(codeInvalidResumeToken)) {
+			// The oplog no longer reaches back to the token, starting over is the only option
+			slog.ErrorContext(ctx, "change stream cannot resume, changes since the last saved event were missed",
+				"saved_at", saved.UpdatedAt, "error", err)
+			if _, err := tokens.DeleteOne(ctx, bson.M{"_id": streamName}); err != nil {
+				return fmt.Errorf("dropping resume token: %w", err)
+			}
+		}
+		return fmt.Errorf("opening change stream: %w", err)
+	}
+	defer stream.Close(context.WithoutCancel(ctx))
+
+	slog.InfoContext(ctx, "change stream started", "resumed", saved.Token != nil)
+	for stream.Next(ctx) {
+		var change changeEvent
+		if err := stream.Decode(&change); err != nil {
+			return fmt.Errorf("decoding change: %w", err)
+		}
+
+		// Subscribers finish the event even during shutdown, then the token is saved
+		bus.Publish(context.WithoutCancel(ctx), change.toEvent())
+
+		_, err := tokens.UpdateOne(context.WithoutCancel(ctx), bson.M{"_id": streamName},
+			bson.M{"$set": bson.M{"token": stream.ResumeToken(), "updated_at": time.Now()}},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			return fmt.Errorf("saving resume token: %w", err)
+		}
+	}
+	return stream.Err()
+}
+
+func (c changeEvent) toEvent() events.Event {
+	sum := sha256.Sum256(c.ID)
+	e := events.Event{
+		ID:         hex.EncodeToString(sum[:16]),
+		Collection: c.NS.Coll,
+		Operation:  c.OperationType,
+		DocumentID: c.DocumentKey.ID,
+		Document:   c.FullDocument,
+		Time:       time.Unix(int64(c.ClusterTime.T), 0),
+	}
+	if c.OperationType == events.Update {
+		elems, _ := c.UpdateDescription.UpdatedFields.Elements()
+		for _, el := range elems {
+			e.Changed = append(e.Changed, el.Key())
+		}
+		e.Changed = append(e.Changed, c.UpdateDescription.RemovedFields...)
+	}
+	return e
+}
@@ -2,50 +2,152 @@ package mongo
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os"
-	"sync"
+	"go2/config"
+	"go2/repository"
+	"log/slog"
+	"time"
 
-	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var (
-	clientInstance *mongo.Client
-	clientOnce     sync.Once
-)
-
-func Connect() *mongo.Client {
-	clientOnce.Do(func() {
-		// Find env
-		err := godotenv.Load(".env")
-		if err != nil {
-			log.Fatalf("Error loading .env file: %s", err)
-		}
+// Store owns the client and the configured database. The repositories it hands out
+// are the MongoDB implementation of the repository interfaces.
+type Store struct {
+	Client *mongo.Client
+	DB     *mongo.Database
+}
 
-		// Get value from env
-		MONGO_URI := os.Getenv("MONGO_URI")
+// Connect opens the client and selects the configured database. A failed ping is retried with
+// exponential backoff up to cfg.ConnectAttempts times, cancelling ctx stops the retries.
+// Every monitor receives an event for each command the client runs.
+func Connect(ctx context.Context, cfg config.MongoConfig, monitors ...*event.CommandMonitor) (*Store, error) {
+	delay := time.Second
+	var lastErr error
 
-		// Connect to database
-		clientOptions := options.Client().ApplyURI(MONGO_URI)
-		client, err := mongo.Connect(context.Background(), clientOptions)
-		if err != nil {
-			log.Fatalf("Failed to connect to MongoDB: %v", err)
+	for attempt := 1; attempt <= cfg.ConnectAttempts; attempt++ {
+		client, err := connectOnce(ctx, options.Client().ApplyURI(cfg.URI).SetMonitor(combineMonitors(monitors)))
+		if err == nil {
+			slog.InfoContext(ctx, "connected to MongoDB", "database", cfg.Database)
+			return &Store{Client: client, DB: client.Database(cfg.Database)}, nil
+		}
+		lastErr = err
+		if attempt == cfg.ConnectAttempts {
+			break
 		}
 
-		// Check the connection
-		if err := client.Ping(context.Background(), nil); err != nil {
-			log.Fatalf("MongoDB not responding: %v", err)
+		slog.WarnContext(ctx, "MongoDB connection failed, retrying",
+			"attempt", attempt, "max_attempts", cfg.ConnectAttempts, "error", err, "retry_in", delay)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
 		}
-		fmt.Println("Connected to MongoDB!!")
-		clientInstance = client
-	})
-	return clientInstance
+		delay = min(delay*2, 30*time.Second)
+	}
+	return nil, fmt.Errorf("giving up on MongoDB after %d attempts: %w", cfg.ConnectAttempts, lastErr)
 }
 
-func GetCollection(dbName, collectionName string) *mongo.Collection {
-	client := Connect()
-	return client.Database(dbName).Collection(collectionName)
+func connectOnce(ctx context.Context, clientOptions *options.ClientOptions) (*mongo.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	// Connect to database
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+
+	// Check the connection
+	if err := client.Ping(ctx, nil); err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, fmt.Errorf("MongoDB not responding: %w", err)
+	}
+	return client, nil
+}
+
+// combineMonitors fans every command event out to all the monitors
+func combineMonitors(monitors []*event.CommandMonitor) *event.CommandMonitor {
+	switch len(monitors) {
+	case 0:
+		return nil
+	case 1:
+		return monitors[0]
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				if m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				if m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
+
+// Ping checks that the server is reachable, used by the readiness probe
+func (s *Store) Ping(ctx context.Context) error {
+	return s.Client.Ping(ctx, nil)
+}
+
+// Close disconnects the client, waiting for in-progress operations until ctx is done
+func (s *Store) Close(ctx context.Context) error {
+	return s.Client.Disconnect(ctx)
+}
+
+// Repositories returns the MongoDB backed repositories
+func (s *Store) Repositories() repository.Repositories {
+	return repository.Repositories{
+		Users:       &userRepository{coll: s.DB.Collection(usersCollection)},
+		Admins:      &adminRepository{coll: s.DB.Collection(adminsCollection)},
+		Tokens:      &tokenRepository{coll: s.DB.Collection(tokensCollection)},
+		Countries:   &countryRepository{coll: s.DB.Collection(countriesCollection)},
+		Outbox:      &outboxRepository{coll: s.DB.Collection(outboxCollection)},
+		Analytics:   &analyticsRepository{users: s.DB.Collection(usersCollection)},
+		Reports:     &reportRepository{coll: s.DB.Collection(reportsCollection)},
+		ReportFiles: &reportFileRepository{db: s.DB},
+		Webhooks:    &webhookRepository{coll: s.DB.Collection(webhooksCollection)},
+		Deliveries:  &deliveryRepository{coll: s.DB.Collection(deliveriesCollection)},
+	}
+}
+
+const (
+	usersCollection        = "users"
+	adminsCollection       = "admins"
+	tokensCollection       = "tokens"
+	countriesCollection    = "countries"
+	outboxCollection       = "email_outbox"
+	reportsCollection      = "report_schedules"
+	reportFilesBucket      = "report_files" // GridFS, the collections are report_files.files and .chunks
+	webhooksCollection     = "webhooks"
+	deliveriesCollection   = "webhook_deliveries"
+	resumeTokensCollection = "change_stream_tokens"
+)
+
+// mapError turns driver errors into the repository errors handlers understand
+func mapError(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return repository.ErrNotFound
+	}
+	if field := DuplicateKeyField(err); field != "" {
+		return &repository.DuplicateError{Field: field}
+	}
+	return err
 }
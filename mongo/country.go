@@ -0,0 +1,32 @@
+package mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type countryRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *countryRepository) List(ctx context.Context) ([]string, error) {
+	cursor, err := r.coll.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var countries []string
+	for cursor.Next(ctx) {
+		var doc struct {
+			Name string `bson:"name"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		countries = append(countries, doc.Name)
+	}
+	return countries, cursor.Err()
+}
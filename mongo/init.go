@@ -3,28 +3,23 @@ package mongo
 import (
 	"context"
 	"fmt"
-	"log"
-	"os"
+	"go2/config"
+	"go2/passhash"
+	"log/slog"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func InitMongoData() {
+// InitData seeds the default countries and, when the admins collection is empty, the configured admin
+func (s *Store) InitData(adminCfg config.AdminConfig, hasher *passhash.Hasher) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	db := os.Getenv("MONGO_DB_NAME")
-	if db == "" {
-		log.Println("MONGO_DB_NAME not set")
-		return
-	}
-
-	countryColl := GetCollection(db, "countries")
+	countryColl := s.DB.Collection(countriesCollection)
 	countryCount, err := countryColl.CountDocuments(ctx, bson.M{})
 	if err != nil {
-		log.Println("Error checking countries:", err)
+		slog.Error("failed to count countries", "error", err)
 	} else if countryCount == 0 {
 		countries := []any{
 			bson.M{"name": "INDIA"},
@@ -32,44 +27,78 @@ func InitMongoData() {
 			bson.M{"name": "FRANCE"},
 		}
 		if _, err := countryColl.InsertMany(ctx, countries); err != nil {
-			log.Println("Failed to insert default countries:", err)
+			slog.Error("failed to insert default countries", "error", err)
 		} else {
-			fmt.Println("Inserted default countries.")
+			slog.Info("inserted default countries")
 		}
 	} else {
-		fmt.Println("Countries already exist.")
+		slog.Debug("countries already exist")
 	}
 
 	//Admins manually insert in database, and forgot password is used for reseting the password
-	adminColl := GetCollection(db, "admins")
+	adminColl := s.DB.Collection(adminsCollection)
 	adminCount, err := adminColl.CountDocuments(ctx, bson.M{})
 	if err != nil {
-		log.Println("Error checking admins:", err)
+		slog.Error("failed to count admins", "error", err)
 		return
 	}
 	if adminCount == 0 {
-		adminEmail := os.Getenv("ADMIN_EMAIL")
-		adminPassword := os.Getenv("ADMIN_PASSWORD")
+		adminEmail := adminCfg.Email
+		adminPassword := adminCfg.Password
 
 		if adminEmail == "" || adminPassword == "" {
-			log.Println("ADMIN_EMAIL or ADMIN_PASSWORD not set")
+			slog.Warn("no admin seeded, ADMIN_EMAIL or ADMIN_PASSWORD not set")
 			return
 		}
 
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(adminPassword), bcrypt.DefaultCost)
+		hashedPassword, err := hasher.Hash(adminPassword)
 		if err != nil {
-			log.Println("Failed to hash admin password:", err)
+			slog.Error("failed to hash admin password", "error", err)
 			return
 		}
 
 		admin := bson.M{
 			"email":    adminEmail,
-			"password": string(hashedPassword),
+			"password": hashedPassword,
 		}
 		if _, err := adminColl.InsertOne(ctx, admin); err != nil {
-			log.Println("Failed to insert default admin:", err)
+			slog.Error("failed to insert default admin", "error", err)
 		} else {
-			fmt.Println("Inserted default admin.")
+			slog.Info("inserted default admin", "email", adminEmail)
 		}
 	}
 }
+
+// legacyResetTokensCollection held admin reset tokens before they moved to the tokens collection
+const legacyResetTokensCollection = "password_reset_tokens"
+
+// MigrateLegacyResetTokens removes the old reset token collection, it is run once by hand with
+// the -migrate-legacy-reset-tokens flag. Its tokens were hashed without a purpose, so they cannot
+// be moved over, links sent in the last 15 minutes before the upgrade have to be requested again.
+// What was removed is logged so that is visible. Without the collection it does nothing.
+func (s *Store) MigrateLegacyResetTokens(ctx context.Context) error {
+	names, err := s.DB.ListCollectionNames(ctx, bson.M{"name": legacyResetTokensCollection})
+	if err != nil {
+		return fmt.Errorf("failed to look for the legacy reset token collection: %w", err)
+	}
+	if len(names) == 0 {
+		slog.Info("no legacy reset token collection, nothing to migrate", "collection", legacyResetTokensCollection)
+		return nil
+	}
+
+	legacy := s.DB.Collection(legacyResetTokensCollection)
+	total, err := legacy.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("failed to count legacy reset tokens: %w", err)
+	}
+	live, err := legacy.CountDocuments(ctx, bson.M{"token_expiry": bson.M{"$gt": time.Now().Unix()}})
+	if err != nil {
+		return fmt.Errorf("failed to count legacy reset tokens: %w", err)
+	}
+	if err := legacy.Drop(ctx); err != nil {
+		return fmt.Errorf("failed to drop the legacy reset token collection: %w", err)
+	}
+	slog.Warn("dropped the legacy reset token collection, unexpired links must be requested again",
+		"collection", legacyResetTokensCollection, "removed", total, "unexpired", live)
+	return nil
+}
@@ -0,0 +1,110 @@
+package mongo
+
+import (
+	"context"
+	"go2/model"
+	"go2/repository"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type outboxRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *outboxRepository) Insert(ctx context.Context, email model.OutboxEmail) error {
+	_, err := r.coll.InsertOne(ctx, email)
+	return err
+}
+
+// Claim leases the next due message to the caller. Messages stuck in sending
+// after a crash are picked up again once their lease runs out.
+func (r *outboxRepository) Claim(ctx context.Context, now, leaseUntil time.Time) (model.OutboxEmail, error) {
+	filter := bson.M{"$or": []bson.M{
+		{"status": model.OutboxPending, "next_attempt_at": bson.M{"$lte": now}},
+		{"status": model.OutboxSending, "locked_until": bson.M{"$lt": now}},
+	}}
+	update := bson.M{"$set": bson.M{"status": model.OutboxSending, "locked_until": leaseUntil}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var email model.OutboxEmail
+	err := r.coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&email)
+	return email, mapError(err)
+}
+
+// MarkSent records the delivery. The body and attachments are dropped, a sent message is only
+// kept as a record until the TTL index removes it.
+func (r *outboxRepository) MarkSent(ctx context.Context, id primitive.ObjectID, attempts int) error {
+	now := time.Now()
+	_, err := r.coll.UpdateByID(ctx, id, bson.M{
+		"$set":   bson.M{"status": model.OutboxSent, "attempts": attempts, "sent_at": now, "finished_at": now},
+		"$unset": bson.M{"locked_until": "", "last_error": "", "html": "", "text": "", "attachments": ""},
+	})
+	return err
+}
+
+// MarkFailed records a failed attempt, status is pending for a retry or dead for the last one.
+// A dead message keeps its body so it can be resent until the TTL index removes it.
+func (r *outboxRepository) MarkFailed(ctx context.Context, id primitive.ObjectID, status string, attempts int, nextAttemptAt time.Time, lastError string) error {
+	set := bson.M{
+		"status":          status,
+		"attempts":        attempts,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	}
+	if status == model.OutboxDead {
+		set["finished_at"] = time.Now()
+	}
+	_, err := r.coll.UpdateByID(ctx, id, bson.M{
+		"$set":   set,
+		"$unset": bson.M{"locked_until": ""},
+	})
+	return err
+}
+
+// ListFailed returns dead messages and messages waiting for a retry, newest first.
+func (r *outboxRepository) ListFailed(ctx context.Context, limit int) ([]model.OutboxEmail, error) {
+	filter := bson.M{"$or": []bson.M{
+		{"status": model.OutboxDead},
+		{"status": model.OutboxPending, "attempts": bson.M{"$gt": 0}},
+	}}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"html": 0, "text": 0, "attachments": 0})
+
+	cursor, err := r.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var emails []model.OutboxEmail
+	if err := cursor.All(ctx, &emails); err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+// Resend puts a failed message back in the queue with a fresh set of attempts.
+func (r *outboxRepository) Resend(ctx context.Context, id primitive.ObjectID) error {
+	res, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "status": bson.M{"$in": []string{model.OutboxDead, model.OutboxPending}}},
+		bson.M{
+			"$set":   bson.M{"status": model.OutboxPending, "attempts": 0, "next_attempt_at": time.Now()},
+			"$unset": bson.M{"last_error": "", "finished_at": ""},
+		})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package mongo
+
+import (
+	"context"
+	"go2/model"
+	"go2/repository"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type reportRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *reportRepository) Insert(ctx context.Context, schedule model.ReportSchedule) error {
+	_, err := r.coll.InsertOne(ctx, schedule)
+	return err
+}
+
+func (r *reportRepository) List(ctx context.Context) ([]model.ReportSchedule, error) {
+	cursor, err := r.coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var schedules []model.ReportSchedule
+	if err := cursor.All(ctx, &schedules); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func (r *reportRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	res, err := r.coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *reportRepository) RunNow(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	res, err := r.coll.UpdateByID(ctx, id, bson.M{"$set": bson.M{"next_run_at": now}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// Claim leases the next due schedule. The update is atomic, so when several instances
+// poll at the same time only one of them gets it. A lease left behind by a crashed
+// instance runs out and the schedule is claimed again.
+func (r *reportRepository) Claim(ctx context.Context, now, leaseUntil time.Time, owner string) (model.ReportSchedule, error) {
+	filter := bson.M{
+		"next_run_at": bson.M{"$lte": now},
+		"$or": []bson.M{
+			{"locked_until": bson.M{"$exists": false}},
+			{"locked_until": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"locked_until": leaseUntil, "locked_by": owner}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_run_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var schedule model.ReportSchedule
+	err := r.coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&schedule)
+	return schedule, mapError(err)
+}
+
+func (r *reportRepository) Complete(ctx context.Context, id primitive.ObjectID, owner string, lastRunAt, nextRunAt time.Time, lastError string) error {
+	set := bson.M{"last_run_at": lastRunAt, "next_run_at": nextRunAt}
+	unset := bson.M{"locked_until": "", "locked_by": ""}
+	if lastError != "" {
+		set["last_error"] = lastError
+	} else {
+		unset["last_error"] = ""
+	}
+
+	res, err := r.coll.UpdateOne(ctx, bson.M{"_id": id, "locked_by": owner}, bson.M{"$set": set, "$unset": unset})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go2/model"
+	"go2/repository"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// reportFileRepository keeps report files in GridFS, a single document could not hold
+// every export
+type reportFileRepository struct {
+	db *mongo.Database
+}
+
+// bucket opens the GridFS bucket. Uploads and downloads take a deadline instead of a
+// context, so the one of ctx is copied over.
+func (r *reportFileRepository) bucket(ctx context.Context) (*gridfs.Bucket, error) {
+	b, err := gridfs.NewBucket(r.db, options.GridFSBucket().SetName(reportFilesBucket))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := b.SetWriteDeadline(deadline); err != nil {
+			return nil, err
+		}
+		if err := b.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (r *reportFileRepository) Save(ctx context.Context, filename string, data []byte) (primitive.ObjectID, error) {
+	b, err := r.bucket(ctx)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return b.UploadFromStream(filename, bytes.NewReader(data))
+}
+
+func (r *reportFileRepository) Open(ctx context.Context, id primitive.ObjectID) (model.ReportFile, error) {
+	b, err := r.bucket(ctx)
+	if err != nil {
+		return model.ReportFile{}, err
+	}
+	stream, err := b.OpenDownloadStream(id)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return model.ReportFile{}, repository.ErrNotFound
+	}
+	if err != nil {
+		return model.ReportFile{}, err
+	}
+	defer stream.Close()
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		return model.ReportFile{}, err
+	}
+	file := stream.GetFile()
+	return model.ReportFile{ID: id, Filename: file.Name, Data: data, CreatedAt: file.UploadDate}, nil
+}
+
+func (r *reportFileRepository) DeleteBefore(ctx context.Context, t time.Time) error {
+	b, err := r.bucket(ctx)
+	if err != nil {
+		return err
+	}
+	cursor, err := b.FindContext(ctx, bson.M{"uploadDate": bson.M{"$lt": t}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var file struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&file); err != nil {
+			return err
+		}
+		if err := b.DeleteContext(ctx, file.ID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return err
+		}
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,315 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Index names are fixed so duplicate key errors can be mapped back to a form field.
+const (
+	userEmailIndex     = "users_email_unique"
+	userMobileIndex    = "users_mobile_unique"
+	adminEmailIndex    = "admins_email_unique"
+	tokenHashIndex     = "tokens_token_unique"
+	tokenOwnerIndex    = "tokens_user_purpose_unique"
+	tokenTTLIndex      = "tokens_expires_at_ttl"
+	outboxDueIndex     = "email_outbox_status_due"
+	outboxTTLIndex     = "email_outbox_finished_at_ttl"
+	reportDueIndex     = "report_schedules_due"
+	webhookEventsIndex = "webhooks_events"
+	deliveryDueIndex   = "webhook_deliveries_status_due"
+	deliveryLogIndex   = "webhook_deliveries_webhook_created"
+	deliveryTTLIndex   = "webhook_deliveries_created_at_ttl"
+)
+
+const (
+	// deliveryRetention is how long the webhook delivery log is kept
+	deliveryRetention = 30 * 24 * time.Hour
+	// outboxRetention is how long sent and dead emails stay in the outbox
+	outboxRetention = 30 * 24 * time.Hour
+)
+
+// requiredIndexes are checked by the readiness probe, per collection
+var requiredIndexes = map[string][]string{
+	usersCollection:      {userEmailIndex, userMobileIndex},
+	adminsCollection:     {adminEmailIndex},
+	tokensCollection:     {tokenHashIndex, tokenOwnerIndex, tokenTTLIndex},
+	outboxCollection:     {outboxDueIndex, outboxTTLIndex},
+	reportsCollection:    {reportDueIndex},
+	webhooksCollection:   {webhookEventsIndex},
+	deliveriesCollection: {deliveryDueIndex, deliveryLogIndex, deliveryTTLIndex},
+}
+
+// duplicateKeyFields maps a unique index name to the form field it protects.
+var duplicateKeyFields = map[string]string{
+	userEmailIndex:  "email",
+	userMobileIndex: "mobile",
+	adminEmailIndex: "email",
+	tokenHashIndex:  "token",
+}
+
+var userSchema = bson.M{
+	"bsonType": "object",
+	"required": []string{"username", "email", "password", "mobile"},
+	"properties": bson.M{
+		"username":         bson.M{"bsonType": "string", "minLength": 1},
+		"email":            bson.M{"bsonType": "string", "pattern": `^[^@\s]+@[^@\s]+$`},
+		"email_verified":   bson.M{"bsonType": "bool"},
+		"password":         bson.M{"bsonType": "string", "minLength": 1},
+		"password_history": bson.M{"bsonType": "array", "items": bson.M{"bsonType": "string"}},
+		"mobile":           bson.M{"bsonType": "string", "pattern": `^(\+\d{1,3})?\d{10}$`},
+		"address":          bson.M{"bsonType": "string"},
+		"gender":           bson.M{"enum": []string{"male", "female"}},
+		"sports":           bson.M{"bsonType": "string"},
+		"dob":              bson.M{"bsonType": "string"},
+		"country":          bson.M{"bsonType": "string"},
+		"image":            bson.M{"bsonType": []string{"binData", "null"}},
+	},
+}
+
+var adminSchema = bson.M{
+	"bsonType": "object",
+	"required": []string{"email", "password"},
+	"properties": bson.M{
+		"email":            bson.M{"bsonType": "string", "pattern": `^[^@\s]+@[^@\s]+$`},
+		"password":         bson.M{"bsonType": "string", "minLength": 1},
+		"password_history": bson.M{"bsonType": "array", "items": bson.M{"bsonType": "string"}},
+	},
+}
+
+var tokenSchema = bson.M{
+	"bsonType": "object",
+	"required": []string{"user_id", "purpose", "token", "expires_at"},
+	"properties": bson.M{
+		"user_id":    bson.M{"bsonType": "objectId"},
+		"purpose":    bson.M{"bsonType": "string", "minLength": 1},
+		"token":      bson.M{"bsonType": "string", "minLength": 1},
+		"expires_at": bson.M{"bsonType": "date"},
+		"created_at": bson.M{"bsonType": "date"},
+	},
+}
+
+// InitSchema creates the JSON schema validators and unique indexes. It runs at startup
+// before InitData so seeding already goes through the validators.
+func (s *Store) InitSchema() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	users := s.DB.Collection(usersCollection)
+	admins := s.DB.Collection(adminsCollection)
+	tokens := s.DB.Collection(tokensCollection)
+
+	if err := ensureValidator(ctx, users, userSchema); err != nil {
+		return err
+	}
+	if err := ensureValidator(ctx, admins, adminSchema); err != nil {
+		return err
+	}
+	if err := ensureValidator(ctx, tokens, tokenSchema); err != nil {
+		return err
+	}
+
+	if err := ensureUniqueIndex(ctx, users, userEmailIndex, "email"); err != nil {
+		return err
+	}
+	if err := ensureUniqueIndex(ctx, users, userMobileIndex, "mobile"); err != nil {
+		return err
+	}
+	if err := ensureUniqueIndex(ctx, admins, adminEmailIndex, "email"); err != nil {
+		return err
+	}
+	if err := ensureUniqueIndex(ctx, tokens, tokenHashIndex, "token"); err != nil {
+		return err
+	}
+	if err := ensureTokenIndexes(ctx, tokens); err != nil {
+		return err
+	}
+
+	if err := ensureOutboxIndexes(ctx, s.DB); err != nil {
+		return err
+	}
+
+	// The report scheduler polls for due schedules by time
+	_, err := s.DB.Collection(reportsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "next_run_at", Value: 1}},
+		Options: options.Index().SetName(reportDueIndex),
+	})
+	if err != nil {
+		return fmt.Errorf("creating index %s: %w", reportDueIndex, err)
+	}
+
+	if err := ensureWebhookIndexes(ctx, s.DB); err != nil {
+		return err
+	}
+
+	slog.Info("MongoDB indexes and validators are in place")
+	return nil
+}
+
+// CheckIndexes reports an error naming every required index that is missing.
+func (s *Store) CheckIndexes(ctx context.Context) error {
+	var missing []string
+	for collName, names := range requiredIndexes {
+		specs, err := s.DB.Collection(collName).Indexes().ListSpecifications(ctx)
+		if err != nil {
+			return fmt.Errorf("listing indexes of %s: %w", collName, err)
+		}
+		existing := make(map[string]bool, len(specs))
+		for _, spec := range specs {
+			existing[spec.Name] = true
+		}
+		for _, name := range names {
+			if !existing[name] {
+				missing = append(missing, collName+"."+name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing indexes: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// ensureValidator attaches the schema to an existing collection, or creates the collection with it.
+func ensureValidator(ctx context.Context, coll *mongo.Collection, schema bson.M) error {
+	validator := bson.M{"$jsonSchema": schema}
+	db := coll.Database()
+
+	names, err := db.ListCollectionNames(ctx, bson.M{"name": coll.Name()})
+	if err != nil {
+		return fmt.Errorf("listing collection %s: %w", coll.Name(), err)
+	}
+
+	if len(names) == 0 {
+		opts := options.CreateCollection().SetValidator(validator)
+		if err := db.CreateCollection(ctx, coll.Name(), opts); err != nil {
+			return fmt.Errorf("creating collection %s: %w", coll.Name(), err)
+		}
+		return nil
+	}
+
+	cmd := bson.D{
+		{Key: "collMod", Value: coll.Name()},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: "moderate"}, // existing invalid documents can still be updated
+	}
+	if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+		return fmt.Errorf("setting validator on %s: %w", coll.Name(), err)
+	}
+	return nil
+}
+
+func ensureUniqueIndex(ctx context.Context, coll *mongo.Collection, name, field string) error {
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: field, Value: 1}},
+		Options: options.Index().SetName(name).SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("creating index %s on %s: %w", name, coll.Name(), err)
+	}
+	return nil
+}
+
+// ensureTokenIndexes allows one live token per user and purpose and lets MongoDB
+// delete tokens once they expire.
+func ensureTokenIndexes(ctx context.Context, tokens *mongo.Collection) error {
+	_, err := tokens.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}},
+			Options: options.Index().SetName(tokenOwnerIndex).SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName(tokenTTLIndex).SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("creating token indexes: %w", err)
+	}
+	return nil
+}
+
+func ensureOutboxIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection(outboxCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// The worker polls for due messages by status and time
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+			Options: options.Index().SetName(outboxDueIndex),
+		},
+		{
+			// Only sent and dead messages have finished_at, queued ones are never removed
+			Keys:    bson.D{{Key: "finished_at", Value: 1}},
+			Options: options.Index().SetName(outboxTTLIndex).SetExpireAfterSeconds(int32(outboxRetention.Seconds())),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("creating outbox indexes: %w", err)
+	}
+	return nil
+}
+
+func ensureWebhookIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection(webhooksCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "events", Value: 1}},
+		Options: options.Index().SetName(webhookEventsIndex),
+	})
+	if err != nil {
+		return fmt.Errorf("creating index %s: %w", webhookEventsIndex, err)
+	}
+
+	_, err = db.Collection(deliveriesCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+			Options: options.Index().SetName(deliveryDueIndex),
+		},
+		{
+			Keys:    bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName(deliveryLogIndex),
+		},
+		{
+			// The log is not kept forever, old deliveries are removed by MongoDB
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetName(deliveryTTLIndex).SetExpireAfterSeconds(int32(deliveryRetention.Seconds())),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("creating webhook delivery indexes: %w", err)
+	}
+	return nil
+}
+
+// DuplicateKeyField returns the form field behind a duplicate key error, or "" for any other error.
+func DuplicateKeyField(err error) string {
+	if !mongo.IsDuplicateKeyError(err) {
+		return ""
+	}
+
+	var we mongo.WriteException
+	if errors.As(err, &we) {
+		for _, e := range we.WriteErrors {
+			if field := fieldFromMessage(e.Message); field != "" {
+				return field
+			}
+		}
+	}
+	return fieldFromMessage(err.Error())
+}
+
+func fieldFromMessage(msg string) string {
+	for index, field := range duplicateKeyFields {
+		if strings.Contains(msg, "index: "+index) {
+			return field
+		}
+	}
+	return ""
+}
@@ -3,30 +3,57 @@ package mongo
 import (
 	"context"
 	"go2/model"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func InsertResetToken(ctx context.Context, userID primitive.ObjectID, tokenHash string, expiry int64) error {
-	_, err := GetCollection("RegistrationMongo", "password_reset_tokens").
-		InsertOne(ctx, bson.M{
-			"user_id":      userID,
-			"token":        tokenHash,
-			"token_expiry": expiry,
-		})
+type tokenRepository struct {
+	coll *mongo.Collection
+}
+
+// Issue stores a token hash for the user and purpose. It replaces any older token for the
+// same pair, so only the most recently issued link works.
+func (r *tokenRepository) Issue(ctx context.Context, userID primitive.ObjectID, purpose, tokenHash string, expiresAt time.Time) error {
+	filter := bson.M{"user_id": userID, "purpose": purpose}
+	token := model.Token{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	_, err := r.coll.ReplaceOne(ctx, filter, token, options.Replace().SetUpsert(true))
 	return err
 }
 
-func FindResetToken(ctx context.Context, tokenHash string) (model.PasswordResetToken, error) {
-	var token model.PasswordResetToken
-	err := GetCollection("RegistrationMongo", "password_reset_tokens").
-		FindOne(ctx, bson.M{"token": tokenHash}).Decode(&token)
-	return token, err
+// Find looks up an unexpired token without using it, e.g. to show the reset form.
+func (r *tokenRepository) Find(ctx context.Context, purpose, tokenHash string) (model.Token, error) {
+	var token model.Token
+	err := r.coll.FindOne(ctx, activeTokenFilter(purpose, tokenHash)).Decode(&token)
+	return token, mapError(err)
+}
+
+// Consume deletes and returns an unexpired token in one step, so it can only be used once.
+func (r *tokenRepository) Consume(ctx context.Context, purpose, tokenHash string) (model.Token, error) {
+	var token model.Token
+	err := r.coll.FindOneAndDelete(ctx, activeTokenFilter(purpose, tokenHash)).Decode(&token)
+	return token, mapError(err)
 }
 
-func DeleteResetTokensByUserID(ctx context.Context, userID primitive.ObjectID) error {
-	_, err := GetCollection("RegistrationMongo", "password_reset_tokens").
-		DeleteMany(ctx, bson.M{"user_id": userID})
+func (r *tokenRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID, purpose string) error {
+	_, err := r.coll.DeleteMany(ctx, bson.M{"user_id": userID, "purpose": purpose})
 	return err
 }
+
+// The TTL monitor only runs about once a minute, so expiry is also checked in the query
+func activeTokenFilter(purpose, tokenHash string) bson.M {
+	return bson.M{
+		"token":      tokenHash,
+		"purpose":    purpose,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+}
@@ -3,43 +3,107 @@ package mongo
 import (
 	"context"
 	"go2/model"
+	"go2/repository"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func GetUserCollection() *mongo.Collection {
-	return GetCollection("RegistrationMongo", "users")
+type userRepository struct {
+	coll *mongo.Collection
 }
 
-func EmailExists(ctx context.Context, email string) bool {
-	count, _ := GetUserCollection().CountDocuments(ctx, bson.M{"email": email})
-	return count > 0
+func (r *userRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	count, err := r.coll.CountDocuments(ctx, bson.M{"email": email})
+	return count > 0, err
 }
 
-func MobileExists(ctx context.Context, mobile string) bool {
-	count, _ := GetUserCollection().CountDocuments(ctx, bson.M{"mobile": mobile})
-	return count > 0
+func (r *userRepository) MobileExists(ctx context.Context, mobile string) (bool, error) {
+	count, err := r.coll.CountDocuments(ctx, bson.M{"mobile": mobile})
+	return count > 0, err
 }
 
-func InsertUser(ctx context.Context, user model.User) error {
-	_, err := GetUserCollection().InsertOne(ctx, user)
-	return err
+func (r *userRepository) Insert(ctx context.Context, user model.User) error {
+	_, err := r.coll.InsertOne(ctx, user)
+	return mapError(err)
 }
 
-func FindUserByID(ctx context.Context, id primitive.ObjectID) (model.User, error) {
+func (r *userRepository) FindByID(ctx context.Context, id primitive.ObjectID) (model.User, error) {
 	var user model.User
-	err := GetUserCollection().FindOne(ctx, bson.M{"_id": id}).Decode(&user)
-	return user, err
+	err := r.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+	return user, mapError(err)
 }
 
-func UpdateUserByID(ctx context.Context, id primitive.ObjectID, update bson.M) error {
-	_, err := GetUserCollection().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": update})
-	return err
+func (r *userRepository) Update(ctx context.Context, user model.User) error {
+	update := bson.M{
+		"username":       user.Username,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"mobile":         user.Mobile,
+		"address":        user.Address,
+		"gender":         user.Gender,
+		"sports":         user.Sports,
+		"dob":            user.DOB,
+		"country":        user.Country,
+		"image":          user.Image,
+	}
+	res, err := r.coll.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": update})
+	if err != nil {
+		return mapError(err)
+	}
+	if res.MatchedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
 }
 
-func DeleteUserByID(ctx context.Context, id primitive.ObjectID) error {
-	_, err := GetUserCollection().DeleteOne(ctx, bson.M{"_id": id})
-	return err
+func (r *userRepository) FindByEmail(ctx context.Context, email string) (model.User, error) {
+	var user model.User
+	err := r.coll.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	return user, mapError(err)
+}
+
+func (r *userRepository) UpdatePassword(ctx context.Context, id primitive.ObjectID, hashedPassword string, history int) error {
+	res, err := r.coll.UpdateByID(ctx, id, passwordUpdate(hashedPassword, history))
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) RehashPassword(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	res, err := r.coll.UpdateOne(ctx, bson.M{"_id": id, "password": oldHash}, bson.M{"$set": bson.M{"password": newHash}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) MarkEmailVerified(ctx context.Context, id primitive.ObjectID) error {
+	res, err := r.coll.UpdateByID(ctx, id, bson.M{"$set": bson.M{"email_verified": true}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	res, err := r.coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
 }
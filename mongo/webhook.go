@@ -0,0 +1,153 @@
+package mongo
+
+import (
+	"context"
+	"go2/model"
+	"go2/repository"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type webhookRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *webhookRepository) Insert(ctx context.Context, webhook model.Webhook) error {
+	_, err := r.coll.InsertOne(ctx, webhook)
+	return err
+}
+
+func (r *webhookRepository) FindByID(ctx context.Context, id primitive.ObjectID) (model.Webhook, error) {
+	var webhook model.Webhook
+	err := r.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&webhook)
+	return webhook, mapError(err)
+}
+
+func (r *webhookRepository) List(ctx context.Context) ([]model.Webhook, error) {
+	return r.find(ctx, bson.M{})
+}
+
+func (r *webhookRepository) ListForEvent(ctx context.Context, event string) ([]model.Webhook, error) {
+	return r.find(ctx, bson.M{"events": event})
+}
+
+func (r *webhookRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	res, err := r.coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *webhookRepository) find(ctx context.Context, filter bson.M) ([]model.Webhook, error) {
+	cursor, err := r.coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var webhooks []model.Webhook
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+type deliveryRepository struct {
+	coll *mongo.Collection
+}
+
+func (r *deliveryRepository) Insert(ctx context.Context, delivery model.WebhookDelivery) error {
+	_, err := r.coll.InsertOne(ctx, delivery)
+	return err
+}
+
+// Claim works like the outbox one, deliveries left in sending by a crash are retried
+// once their lease runs out.
+func (r *deliveryRepository) Claim(ctx context.Context, now, leaseUntil time.Time) (model.WebhookDelivery, error) {
+	filter := bson.M{"$or": []bson.M{
+		{"status": model.DeliveryPending, "next_attempt_at": bson.M{"$lte": now}},
+		{"status": model.DeliverySending, "locked_until": bson.M{"$lt": now}},
+	}}
+	update := bson.M{"$set": bson.M{"status": model.DeliverySending, "locked_until": leaseUntil}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var delivery model.WebhookDelivery
+	err := r.coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+	return delivery, mapError(err)
+}
+
+func (r *deliveryRepository) MarkDelivered(ctx context.Context, id primitive.ObjectID, attempts, responseCode int) error {
+	_, err := r.coll.UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{
+			"status":        model.DeliveryDelivered,
+			"attempts":      attempts,
+			"response_code": responseCode,
+			"delivered_at":  time.Now(),
+		},
+		"$unset": bson.M{"locked_until": "", "last_error": ""},
+	})
+	return err
+}
+
+func (r *deliveryRepository) MarkFailed(ctx context.Context, id primitive.ObjectID, status string, attempts, responseCode int, nextAttemptAt time.Time, lastError string) error {
+	_, err := r.coll.UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{
+			"status":          status,
+			"attempts":        attempts,
+			"response_code":   responseCode,
+			"next_attempt_at": nextAttemptAt,
+			"last_error":      lastError,
+		},
+		"$unset": bson.M{"locked_until": ""},
+	})
+	return err
+}
+
+func (r *deliveryRepository) List(ctx context.Context, webhookID primitive.ObjectID, limit int) ([]model.WebhookDelivery, error) {
+	filter := bson.M{}
+	if !webhookID.IsZero() {
+		filter["webhook_id"] = webhookID
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var deliveries []model.WebhookDelivery
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (r *deliveryRepository) Redeliver(ctx context.Context, id primitive.ObjectID) error {
+	res, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "status": bson.M{"$in": bson.A{model.DeliveryDelivered, model.DeliveryDead}}},
+		bson.M{
+			"$set":   bson.M{"status": model.DeliveryPending, "attempts": 0, "next_attempt_at": time.Now()},
+			"$unset": bson.M{"last_error": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"go2/mailer"
+	"go2/model"
+	"go2/repository"
+	"log/slog"
+	"time"
+)
+
+// Queue is a mailer.Mailer that stores messages in the outbox instead of sending them.
+// The Worker delivers them in the background.
+type Queue struct {
+	repo repository.OutboxRepository
+}
+
+func NewQueue(repo repository.OutboxRepository) *Queue {
+	return &Queue{repo: repo}
+}
+
+func (q *Queue) Send(ctx context.Context, msg mailer.Message) error {
+	now := time.Now()
+	return q.repo.Insert(ctx, model.OutboxEmail{
+		From:          msg.From,
+		To:            msg.To,
+		Subject:       msg.Subject,
+		HTML:          msg.HTML,
+		Text:          msg.Text,
+		Attachments:   toModel(msg.Attachments),
+		Status:        model.OutboxPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	})
+}
+
+// Worker delivers queued messages with exponential backoff between attempts.
+type Worker struct {
+	Repo         repository.OutboxRepository
+	Mailer       mailer.Mailer
+	PollInterval time.Duration
+	MaxAttempts  int           // after this many failures the message is marked dead
+	BaseDelay    time.Duration // delay after the first failure, doubled for every further one
+	MaxDelay     time.Duration
+	SendTimeout  time.Duration
+}
+
+func NewWorker(repo repository.OutboxRepository, m mailer.Mailer) *Worker {
+	return &Worker{
+		Repo:         repo,
+		Mailer:       m,
+		PollInterval: 5 * time.Second,
+		MaxAttempts:  6,
+		BaseDelay:    30 * time.Second,
+		MaxDelay:     time.Hour,
+		SendTimeout:  30 * time.Second,
+	}
+}
+
+// Run polls the outbox until ctx is cancelled, then returns after the current message.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain everything that is due before waiting for the next tick
+		for w.processOne(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processOne sends a single due message and reports whether there was one.
+func (w *Worker) processOne(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	now := time.Now()
+	email, err := w.Repo.Claim(ctx, now, now.Add(w.SendTimeout*2))
+	if errors.Is(err, repository.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "outbox: failed to claim email", "error", err)
+		return false
+	}
+
+	// A message that is already being sent is finished even during shutdown
+	ctx = context.WithoutCancel(ctx)
+	sendCtx, cancel := context.WithTimeout(ctx, w.SendTimeout)
+	err = w.Mailer.Send(sendCtx, mailer.Message{
+		From:        email.From,
+		To:          email.To,
+		Subject:     email.Subject,
+		HTML:        email.HTML,
+		Text:        email.Text,
+		Attachments: toMailer(email.Attachments),
+	})
+	cancel()
+
+	attempts := email.Attempts + 1
+	if err == nil {
+		if err := w.Repo.MarkSent(ctx, email.ID, attempts); err != nil {
+			slog.ErrorContext(ctx, "outbox: failed to mark email as sent", "email_id", email.ID.Hex(), "error", err)
+		}
+		return true
+	}
+
+	status := model.OutboxPending
+	if attempts >= w.MaxAttempts {
+		status = model.OutboxDead
+	}
+	slog.WarnContext(ctx, "outbox: delivery failed",
+		"email_id", email.ID.Hex(), "attempt", attempts, "status", status, "error", err)
+	next := time.Now().Add(w.backoff(attempts))
+	if err := w.Repo.MarkFailed(ctx, email.ID, status, attempts, next, err.Error()); err != nil {
+		slog.ErrorContext(ctx, "outbox: failed to record attempt", "email_id", email.ID.Hex(), "error", err)
+	}
+	return true
+}
+
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.BaseDelay
+	for i := 1; i < attempts && delay < w.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, w.MaxDelay)
+}
+
+func toModel(attachments []mailer.Attachment) []model.Attachment {
+	var out []model.Attachment
+	for _, a := range attachments {
+		out = append(out, model.Attachment{Filename: a.Filename, ContentType: a.ContentType, Data: a.Data})
+	}
+	return out
+}
+
+func toMailer(attachments []model.Attachment) []mailer.Attachment {
+	var out []mailer.Attachment
+	for _, a := range attachments {
+		out = append(out, mailer.Attachment{Filename: a.Filename, ContentType: a.ContentType, Data: a.Data})
+	}
+	return out
+}
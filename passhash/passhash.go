@@ -0,0 +1,130 @@
+// Package passhash hashes passwords with bcrypt or Argon2id. The algorithm and its parameters
+// are part of the encoded hash, so hashes made with older settings keep verifying and can be
+// recognised and upgraded when the user next logs in.
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go2/config"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithms
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+const (
+	saltLength = 16
+	keyLength  = 32
+)
+
+var ErrMalformed = errors.New("passhash: malformed hash")
+
+// Hasher makes new hashes with the preferred algorithm and parameters
+type Hasher struct {
+	Algorithm  string
+	BcryptCost int
+	Time       uint32 // Argon2id passes over the memory
+	Memory     uint32 // Argon2id memory in KiB
+	Threads    uint8  // Argon2id lanes
+}
+
+func New(cfg config.PasswordConfig) *Hasher {
+	return &Hasher{
+		Algorithm:  cfg.Algorithm,
+		BcryptCost: cfg.BcryptCost,
+		Time:       uint32(cfg.Argon2Time),
+		Memory:     uint32(cfg.Argon2Memory),
+		Threads:    uint8(cfg.Argon2Threads),
+	}
+}
+
+// Hash returns the encoded hash of password, "$2a$<cost>$..." for bcrypt and the PHC string
+// format "$argon2id$v=19$m=<KiB>,t=<time>,p=<threads>$<salt>$<key>" for Argon2id
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.Algorithm == Bcrypt {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		return string(hashed), err
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, keyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// NeedsRehash reports whether encoded was made with another algorithm or other parameters
+// than the preferred ones
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	switch h.Algorithm {
+	case Bcrypt:
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost != h.BcryptCost
+	default:
+		p, err := decodeArgon2(encoded)
+		return err != nil || p.version != argon2.Version || p.memory != h.Memory || p.time != h.Time ||
+			p.threads != h.Threads || len(p.key) != keyLength
+	}
+}
+
+// Verify reports whether password matches encoded, whatever algorithm and parameters made it.
+// A malformed or empty hash never matches.
+func Verify(password, encoded string) bool {
+	if strings.HasPrefix(encoded, "$argon2id$") {
+		p, err := decodeArgon2(encoded)
+		if err != nil {
+			return false
+		}
+		key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+		return subtle.ConstantTimeCompare(key, p.key) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+}
+
+type argon2Params struct {
+	version int
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func decodeArgon2(encoded string) (argon2Params, error) {
+	var p argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return p, ErrMalformed
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &p.version); err != nil {
+		return p, ErrMalformed
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, ErrMalformed
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, ErrMalformed
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return p, ErrMalformed
+	}
+	if p.time == 0 || p.threads == 0 {
+		return p, ErrMalformed
+	}
+	return p, nil
+}
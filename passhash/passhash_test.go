@@ -0,0 +1,132 @@
+package passhash
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	bcryptHasher = &Hasher{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost}
+	argon2Hasher = &Hasher{Algorithm: Argon2id, Time: 1, Memory: 64, Threads: 1}
+)
+
+func TestHashVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher *Hasher
+		prefix string
+	}{
+		{"bcrypt", bcryptHasher, "$2a$04$"},
+		{"argon2id", argon2Hasher, "$argon2id$v=19$m=64,t=1,p=1$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := tt.hasher.Hash("Secret#123")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(encoded, tt.prefix) {
+				t.Errorf("hash %q, want prefix %q", encoded, tt.prefix)
+			}
+			if !Verify("Secret#123", encoded) {
+				t.Error("the password does not verify against its own hash")
+			}
+			if Verify("Secret#124", encoded) {
+				t.Error("another password verifies")
+			}
+			if again, _ := tt.hasher.Hash("Secret#123"); again == encoded {
+				t.Error("two hashes of the same password are equal, the salt is not random")
+			}
+		})
+	}
+
+	for _, encoded := range []string{"", "plain", "$argon2id$", "$2a$04$short"} {
+		if Verify("", encoded) || Verify("plain", encoded) {
+			t.Errorf("Verify matched the malformed hash %q", encoded)
+		}
+	}
+}
+
+func TestDecodeArgon2(t *testing.T) {
+	valid, err := argon2Hasher.Hash("Secret#123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := decodeArgon2(valid)
+	if err != nil || p.version != 19 || p.memory != 64 || p.time != 1 || p.threads != 1 || len(p.salt) != saltLength || len(p.key) != keyLength {
+		t.Fatalf("decodeArgon2(%q) = %+v, %v", valid, p, err)
+	}
+
+	parts := strings.Split(valid, "$")
+	salt, key := parts[4], parts[5]
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"empty", ""},
+		{"bcrypt", "$2a$04$abcdefghijklmnopqrstuu5D6Wqy0c5bJ0s8r3hTjNhGEYqX0Kq5C"},
+		{"argon2i", "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key},
+		{"too few parts", "$argon2id$v=19$m=64,t=1,p=1$" + salt},
+		{"too many parts", valid + "$extra"},
+		{"bad version", "$argon2id$v=x$m=64,t=1,p=1$" + salt + "$" + key},
+		{"missing version", "$argon2id$$m=64,t=1,p=1$" + salt + "$" + key},
+		{"missing params", "$argon2id$v=19$$" + salt + "$" + key},
+		{"missing threads", "$argon2id$v=19$m=64,t=1$" + salt + "$" + key},
+		{"zero time", "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key},
+		{"zero threads", "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key},
+		{"bad salt base64", "$argon2id$v=19$m=64,t=1,p=1$not*base64$" + key},
+		{"bad key base64", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$not*base64"},
+		{"padded key", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$" + base64.StdEncoding.EncodeToString([]byte("k"))},
+		{"empty key", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeArgon2(tt.encoded); err != ErrMalformed {
+				t.Errorf("decodeArgon2(%q) = %v, want ErrMalformed", tt.encoded, err)
+			}
+			if Verify("Secret#123", tt.encoded) {
+				t.Errorf("Verify matched %q", tt.encoded)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptHash, err := bcryptHasher.Hash("Secret#123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argon2Hash, err := argon2Hasher.Hash("Secret#123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		hasher  *Hasher
+		encoded string
+		want    bool
+	}{
+		{"bcrypt same cost", bcryptHasher, bcryptHash, false},
+		{"bcrypt higher cost", &Hasher{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost + 1}, bcryptHash, true},
+		{"bcrypt to argon2id", argon2Hasher, bcryptHash, true},
+		{"argon2id same params", argon2Hasher, argon2Hash, false},
+		{"argon2id to bcrypt", bcryptHasher, argon2Hash, true},
+		{"argon2id more time", &Hasher{Algorithm: Argon2id, Time: 2, Memory: 64, Threads: 1}, argon2Hash, true},
+		{"argon2id more memory", &Hasher{Algorithm: Argon2id, Time: 1, Memory: 128, Threads: 1}, argon2Hash, true},
+		{"argon2id more threads", &Hasher{Algorithm: Argon2id, Time: 1, Memory: 64, Threads: 2}, argon2Hash, true},
+		{"older argon2 version", argon2Hasher, strings.Replace(argon2Hash, "v=19", "v=16", 1), true},
+		{"malformed for bcrypt", bcryptHasher, "plain", true},
+		{"malformed for argon2id", argon2Hasher, "plain", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.encoded); got != tt.want {
+				t.Errorf("NeedsRehash(%q) = %v, want %v", tt.encoded, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// Package passpolicy checks new passwords against the configured rules, a bundled list of
+// common passwords and an optional local copy of a breached password corpus.
+package passpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go2/config"
+	"go2/passhash"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// MaxLength is the most bcrypt hashes, longer passwords are refused rather than cut off. It
+// applies to Argon2id too, so the algorithm can be switched back without locking anyone out.
+const MaxLength = 72
+
+//go:embed common.txt
+var commonList []byte
+
+// common is the bundled list, lower case
+var common = parseList(commonList)
+
+type Policy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	History       int    // earlier passwords that may not be used again
+	BreachDir     string // directory of SHA-1 range files, empty skips the check
+}
+
+func New(cfg config.PasswordConfig) *Policy {
+	return &Policy{
+		MinLength:     cfg.MinLength,
+		RequireUpper:  cfg.RequireUpper,
+		RequireLower:  cfg.RequireLower,
+		RequireDigit:  cfg.RequireDigit,
+		RequireSymbol: cfg.RequireSymbol,
+		History:       cfg.History,
+		BreachDir:     cfg.BreachDir,
+	}
+}
+
+// Check returns every rule the password breaks as a sentence for the form, nil when it is
+// acceptable. previous are the hashes of the current and earlier passwords of the account, bcrypt
+// or Argon2id, see passhash.Verify.
+func (p *Policy) Check(password string, previous ...string) []string {
+	var problems []string
+
+	if n := len([]rune(password)); n < p.MinLength {
+		problems = append(problems, fmt.Sprintf("Password must be at least %d characters long.", p.MinLength))
+	}
+	if len(password) > MaxLength {
+		problems = append(problems, fmt.Sprintf("Password must be at most %d bytes long.", MaxLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		problems = append(problems, "Password must contain an uppercase letter.")
+	}
+	if p.RequireLower && !lower {
+		problems = append(problems, "Password must contain a lowercase letter.")
+	}
+	if p.RequireDigit && !digit {
+		problems = append(problems, "Password must contain a digit.")
+	}
+	if p.RequireSymbol && !symbol {
+		problems = append(problems, "Password must contain a symbol such as ! or #.")
+	}
+
+	if p.Breached(password) {
+		problems = append(problems, "This password is too common or has appeared in a data breach, choose another one.")
+	}
+	if p.Reused(password, previous) {
+		if p.History == 0 {
+			problems = append(problems, "Password must differ from your current password.")
+		} else {
+			problems = append(problems, fmt.Sprintf("Password must differ from your last %d passwords.", p.History+1))
+		}
+	}
+	return problems
+}
+
+// Reused reports whether the password matches one of the hashes, only the first History+1
+// (the current password and the remembered ones) are compared
+func (p *Policy) Reused(password string, hashes []string) bool {
+	for i, hash := range hashes {
+		if i > p.History {
+			break
+		}
+		if hash != "" && passhash.Verify(password, hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// Breached reports whether the password is on the bundled list or in the local breach corpus.
+// A corpus that cannot be read is logged and treated as not containing the password.
+func (p *Policy) Breached(password string) bool {
+	if common[strings.ToLower(password)] {
+		return true
+	}
+	if p.BreachDir == "" {
+		return false
+	}
+	found, err := inRangeFile(p.BreachDir, password)
+	if err != nil {
+		slog.Warn("password breach check skipped", "error", err)
+	}
+	return found
+}
+
+// inRangeFile looks the password up in a k-anonymity range file, as served by the Pwned
+// Passwords range API and saved by its downloader: the file <dir>/<first 5 hex of the SHA-1>.txt
+// lists the remaining 35 characters of every hash with that prefix as "SUFFIX:COUNT" lines.
+// Only the prefix file is read, the full hash of the password never leaves this function.
+func inRangeFile(dir, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil // an incomplete corpus, nothing is known about this prefix
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+	return false, sc.Err()
+}
+
+func parseList(data []byte) map[string]bool {
+	list := make(map[string]bool)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		s := strings.TrimSpace(string(line))
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		list[strings.ToLower(s)] = true
+	}
+	return list
+}
@@ -0,0 +1,122 @@
+package passpolicy
+
+import (
+	"go2/passhash"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testdata/breach holds two range files: 52E6B.txt lists the hash of "Breached#Pass1", 2B131.txt
+// has the prefix of "Unseen#Pass2" but not its suffix
+const (
+	breachedPassword = "Breached#Pass1"
+	unseenPassword   = "Unseen#Pass2"
+)
+
+func TestCheck(t *testing.T) {
+	strict := &Policy{MinLength: 8, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		password string
+		want     []string
+	}{
+		{"acceptable", strict, "Tr0ub4dor&3", nil},
+		{"too short", strict, "Ab1#", []string{"Password must be at least 8 characters long."}},
+		{"length in runes", &Policy{MinLength: 4}, "ééé", []string{"Password must be at least 4 characters long."}},
+		{"multibyte long enough", &Policy{MinLength: 4}, "éééé", nil},
+		{"too long", &Policy{}, strings.Repeat("x", MaxLength+1), []string{"Password must be at most 72 bytes long."}},
+		{"no uppercase", strict, "tr0ub4dor&3", []string{"Password must contain an uppercase letter."}},
+		{"no lowercase", strict, "TR0UB4DOR&3", []string{"Password must contain a lowercase letter."}},
+		{"no digit", strict, "Troubador&x", []string{"Password must contain a digit."}},
+		{"no symbol", strict, "Tr0ub4dor03", []string{"Password must contain a symbol such as ! or #."}},
+		{"space counts as symbol", strict, "Tr0ub4dor 3", nil},
+		{"classes not required", &Policy{MinLength: 8}, "xkcdxkcdxkcd", nil},
+		{"every problem at once", strict, "abc", []string{
+			"Password must be at least 8 characters long.",
+			"Password must contain an uppercase letter.",
+			"Password must contain a digit.",
+			"Password must contain a symbol such as ! or #.",
+		}},
+		{"common", &Policy{MinLength: 6}, "password", []string{
+			"This password is too common or has appeared in a data breach, choose another one.",
+		}},
+		{"common in another case", &Policy{MinLength: 6}, "PassWord", []string{
+			"This password is too common or has appeared in a data breach, choose another one.",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Check(tt.password); !slices.Equal(got, tt.want) {
+				t.Errorf("Check(%q) = %q, want %q", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReused(t *testing.T) {
+	hash := func(password string) string {
+		h, err := (&passhash.Hasher{Algorithm: passhash.Bcrypt, BcryptCost: bcrypt.MinCost}).Hash(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	argon2, err := (&passhash.Hasher{Algorithm: passhash.Argon2id, Time: 1, Memory: 64, Threads: 1}).Hash("Second#Pass2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The current password first, then the remembered ones, newest first
+	previous := []string{hash("Current#Pass1"), argon2, "", hash("Third#Pass3"), hash("Fourth#Pass4")}
+
+	tests := []struct {
+		name     string
+		history  int
+		password string
+		want     []string
+	}{
+		{"new password", 3, "Brand#New5", nil},
+		{"current password", 0, "Current#Pass1", []string{"Password must differ from your current password."}},
+		{"remembered argon2id", 3, "Second#Pass2", []string{"Password must differ from your last 4 passwords."}},
+		{"oldest remembered", 3, "Third#Pass3", []string{"Password must differ from your last 4 passwords."}},
+		{"beyond the history", 2, "Fourth#Pass4", nil},
+		{"beyond no history", 0, "Second#Pass2", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Policy{MinLength: 8, History: tt.history}
+			if got := p.Check(tt.password, previous...); !slices.Equal(got, tt.want) {
+				t.Errorf("Check(%q) = %q, want %q", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreached(t *testing.T) {
+	tests := []struct {
+		name      string
+		breachDir string
+		password  string
+		want      bool
+	}{
+		{"listed in its range file", "testdata/breach", breachedPassword, true},
+		{"range file without the suffix", "testdata/breach", unseenPassword, false},
+		{"no range file for the prefix", "testdata/breach", "No#RangeFile3", false},
+		{"common without a corpus", "", "qwerty", true},
+		{"common with a corpus", "testdata/breach", "qwerty", true},
+		{"corpus not configured", "", breachedPassword, false},
+		{"missing corpus directory", "testdata/missing", breachedPassword, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Policy{BreachDir: tt.breachDir}
+			if got := p.Breached(tt.password); got != tt.want {
+				t.Errorf("Breached(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
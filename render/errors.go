@@ -0,0 +1,100 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"go2/logging"
+	"go2/model"
+	"html/template"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// errorTexts are the headings and default messages of the branded error pages
+var errorTexts = map[int][2]string{
+	http.StatusBadRequest:          {"Bad request", "The request could not be understood."},
+	http.StatusForbidden:           {"Access denied", "You are not allowed to do this. If you submitted a form, reload the page and try again."},
+	http.StatusNotFound:            {"Page not found", "The page you are looking for does not exist or was moved."},
+	http.StatusMethodNotAllowed:    {"Method not allowed", "This page cannot be used that way."},
+	http.StatusInternalServerError: {"Something went wrong", "An unexpected error occurred. Please try again later."},
+	http.StatusServiceUnavailable:  {"Down for maintenance", "We are doing some maintenance and will be back shortly."},
+}
+
+// Error answers with the error page for status. API clients, recognised by the Accept header or an
+// /api/ path, get JSON instead. An empty message uses the default text for the status.
+func Error(w http.ResponseWriter, r *http.Request, status int, message string) {
+	heading, fallback := errorText(status)
+	if message == "" {
+		message = fallback
+	}
+
+	if WantsJSON(r) {
+		writeErrorJSON(w, r, status, message)
+		return
+	}
+
+	temp := "Error.html"
+	if status == http.StatusServiceUnavailable {
+		temp = "Maintenance.html"
+	}
+	RenderTemplateWithStatus(w, r, status, temp, model.ErrorPageData{
+		Title:     heading,
+		Status:    status,
+		Heading:   heading,
+		Message:   message,
+		RequestID: logging.RequestID(r.Context()),
+	})
+}
+
+// WantsJSON reports whether the client prefers JSON over HTML
+func WantsJSON(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		return true
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		// The first type the client lists decides, browsers always list text/html first
+		switch mediaType {
+		case "application/json":
+			return true
+		case "text/html":
+			return false
+		}
+	}
+	return false
+}
+
+func errorText(status int) (heading, message string) {
+	if t, ok := errorTexts[status]; ok {
+		return t[0], t[1]
+	}
+	return http.StatusText(status), "The request could not be completed."
+}
+
+func writeErrorJSON(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error":      message,
+		"status":     status,
+		"request_id": logging.RequestID(r.Context()),
+	})
+}
+
+// fallbackError is used when the templates themselves are broken, it needs no template
+func fallbackError(w http.ResponseWriter, r *http.Request, status int) {
+	heading, message := errorText(status)
+	if WantsJSON(r) {
+		writeErrorJSON(w, r, status, message)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<!DOCTYPE html><html><head><title>%s</title></head><body><h1>%s</h1><p>%s</p><p><small>Request ID: %s</small></p></body></html>",
+		heading, heading, message, template.HTMLEscapeString(logging.RequestID(r.Context())))
+}
@@ -1,12 +1,29 @@
 package render
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go2/csrf"
+	"go2/flash"
 	"html/template"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net/http"
-	"path/filepath"
+	"os"
+	"path"
+	"sync"
+	"time"
 )
 
+// layoutFiles are parsed together with every page
+var layoutFiles = []string{"Base.html", "Header.html", "Footer.html", "Flash.html"}
+
+// StaticURL builds the link to a static file for the "static" template helper. main replaces
+// it with the fingerprinting version before calling Load.
+var StaticURL = func(name string) string { return "/static/" + name }
+
 var funcMap = template.FuncMap{
 	"add": func(a, b int) int { return a + b },
 	"sub": func(a, b int) int { return a - b },
@@ -17,30 +34,154 @@ var funcMap = template.FuncMap{
 		}
 		return s
 	},
+	"static": func(name string) string { return StaticURL(name) },
+	// replaced per request by requestFuncs, defined here so pages parse
+	"csrfToken": func() string { return "" },
+	"csrfField": func() template.HTML { return "" },
+	"flashes":   func() []flash.Message { return nil },
 }
 
-func RenderTemplate(w http.ResponseWriter, temp string) {
-	RenderTemplateWithData(w, temp, nil)
+var (
+	cacheMu sync.RWMutex
+	cache   map[string]*template.Template // page file name -> layout plus page
+)
+
+// Load parses every page of fsys together with the layout and replaces the cache.
+// On error the previous cache stays in place.
+func Load(fsys fs.FS) error {
+	names, err := fs.Glob(fsys, "*.html")
+	if err != nil {
+		return err
+	}
+
+	pages := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		if isLayout(name) {
+			continue
+		}
+		files := append(append([]string{}, layoutFiles...), name)
+		t, err := template.New(layoutFiles[0]).Funcs(funcMap).ParseFS(fsys, files...)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", name, err)
+		}
+		pages[name] = t
+	}
+
+	cacheMu.Lock()
+	cache = pages
+	cacheMu.Unlock()
+	return nil
 }
 
-func RenderTemplateWithData(w http.ResponseWriter, temp string, data any) {
-	tmplFiles := []string{
-		filepath.Join("templates", "base.html"),
-		filepath.Join("templates", "header.html"),
-		filepath.Join("templates", "footer.html"),
-		filepath.Join("templates", temp),
+// Watch reloads the templates from dir whenever a file in it changes, for development.
+// It polls so it works the same on every OS and inside containers with mounted volumes.
+func Watch(ctx context.Context, dir string, interval time.Duration) {
+	last := dirStamp(dir)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stamp := dirStamp(dir)
+		if stamp == last {
+			continue
+		}
+		last = stamp
+		if err := Load(os.DirFS(dir)); err != nil {
+			slog.Error("template reload failed, keeping the previous templates", "error", err)
+			continue
+		}
+		slog.Info("templates reloaded", "dir", dir)
 	}
+}
 
-	t, err := template.New("base.html").Funcs(funcMap).ParseFiles(tmplFiles...)
+// dirStamp summarises the names, sizes and modification times of the pages in dir
+func dirStamp(dir string) string {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		log.Println("Template parse error:", err)
-		http.Error(w, "Template rendering failed. Please try again later.", http.StatusInternalServerError)
-		return
+		return ""
+	}
+	var b bytes.Buffer
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || e.IsDir() {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", e.Name(), info.Size(), info.ModTime().UnixNano())
 	}
+	return b.String()
+}
 
-	err = t.ExecuteTemplate(w, "base.html", data)
+func isLayout(name string) bool {
+	for _, l := range layoutFiles {
+		if l == name {
+			return true
+		}
+	}
+	return false
+}
+
+func RenderTemplate(w http.ResponseWriter, r *http.Request, temp string) {
+	RenderTemplateWithData(w, r, temp, nil)
+}
+
+func RenderTemplateWithData(w http.ResponseWriter, r *http.Request, temp string, data any) {
+	RenderTemplateWithStatus(w, r, http.StatusOK, temp, data)
+}
+
+// RenderTemplateWithStatus renders into a buffer first, so a failing template still ends in a
+// clean 500 page instead of half a page with a 200 status.
+func RenderTemplateWithStatus(w http.ResponseWriter, r *http.Request, status int, temp string, data any) {
+	t, err := lookup(temp)
+	if err == nil {
+		// Clone so the request bound helpers never leak into another request
+		t, err = t.Clone()
+	}
 	if err != nil {
-		log.Println("Template execution error:", err)
-		http.Error(w, "Template execution failed. Please try again later.", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "template lookup failed", "template", temp, "error", err)
+		fallbackError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := t.Funcs(requestFuncs(w, r)).ExecuteTemplate(&buf, layoutFiles[0], data); err != nil {
+		slog.ErrorContext(r.Context(), "template execution failed", "template", temp, "error", err)
+		fallbackError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+}
+
+func lookup(temp string) (*template.Template, error) {
+	cacheMu.RLock()
+	defer cacheMu.RUnlock()
+
+	if cache == nil {
+		return nil, errors.New("templates not loaded")
+	}
+	t, ok := cache[path.Clean(temp)]
+	if !ok {
+		return nil, fmt.Errorf("no template named %s", temp)
+	}
+	return t, nil
+}
+
+// requestFuncs are the template functions that depend on the current request
+func requestFuncs(w http.ResponseWriter, r *http.Request) template.FuncMap {
+	return template.FuncMap{
+		"flashes":   func() []flash.Message { return flash.Pop(w, r) },
+		"csrfToken": func() string { return csrf.Token(r) },
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + csrf.FieldName + `" value="` +
+				template.HTMLEscapeString(csrf.Token(r)) + `">`)
+		},
 	}
 }
@@ -0,0 +1,160 @@
+// Package reports builds the CSV reports admins schedule and runs them on time.
+package reports
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"go2/model"
+	"go2/repository"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Kinds lists every report in the order shown on the admin page
+var Kinds = []string{model.ReportNewUsersByCountry, model.ReportUserExport}
+
+var descriptions = map[string]string{
+	model.ReportNewUsersByCountry: "New users by country",
+	model.ReportUserExport:        "Full user export",
+}
+
+// Describe returns the human readable name of a report kind
+func Describe(kind string) string {
+	if d, ok := descriptions[kind]; ok {
+		return d
+	}
+	return kind
+}
+
+// Period is the time a report covers, the day or week before it runs
+func Period(frequency string) time.Duration {
+	if frequency == model.FrequencyWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// NextRun returns the first time after "after" the schedule is due, in UTC
+func NextRun(s model.ReportSchedule, after time.Time) time.Time {
+	after = after.UTC()
+	next := time.Date(after.Year(), after.Month(), after.Day(), s.Hour, 0, 0, 0, time.UTC)
+	if s.Frequency == model.FrequencyWeekly {
+		next = next.AddDate(0, 0, (int(s.Weekday)-int(next.Weekday())+7)%7)
+	}
+	for !next.After(after) {
+		if s.Frequency == model.FrequencyWeekly {
+			next = next.AddDate(0, 0, 7)
+		} else {
+			next = next.AddDate(0, 0, 1)
+		}
+	}
+	return next
+}
+
+// Report is a generated CSV file
+type Report struct {
+	Filename string
+	Data     []byte
+	Rows     int       // data rows, without the header
+	From     time.Time // zero for reports that are not about a period
+	To       time.Time
+}
+
+// exportPageSize is how many users the export reads per query
+const exportPageSize = 500
+
+// Generate builds the report of the schedule for the period ending at "to".
+func Generate(ctx context.Context, repos repository.Repositories, s model.ReportSchedule, to time.Time) (Report, error) {
+	to = to.UTC()
+	report := Report{From: to.Add(-Period(s.Frequency)), To: to}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	var err error
+	switch s.Kind {
+	case model.ReportNewUsersByCountry:
+		report.Rows, err = newUsersByCountry(ctx, repos.Analytics, w, report.From, report.To)
+	case model.ReportUserExport:
+		report.From = time.Time{} // every user, not a period
+		report.Rows, err = userExport(ctx, repos.Users, w)
+	default:
+		err = fmt.Errorf("unknown report kind %q", s.Kind)
+	}
+	if err != nil {
+		return Report{}, err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return Report{}, err
+	}
+
+	report.Filename = fmt.Sprintf("%s-%s.csv", s.Kind, to.Format("2006-01-02"))
+	report.Data = buf.Bytes()
+	return report, nil
+}
+
+func newUsersByCountry(ctx context.Context, repo repository.AnalyticsRepository, w *csv.Writer, from, to time.Time) (int, error) {
+	stats, err := repo.UserStats(ctx, model.StatsFilter{From: from, To: to, Interval: model.IntervalDay})
+	if err != nil {
+		return 0, err
+	}
+	if err := w.Write([]string{"country", "new_users"}); err != nil {
+		return 0, err
+	}
+	for _, c := range stats.ByCountry {
+		if err := w.Write([]string{safeCell(c.Label), strconv.FormatInt(c.Count, 10)}); err != nil {
+			return 0, err
+		}
+	}
+	return len(stats.ByCountry), w.Write([]string{"Total", strconv.FormatInt(stats.Total, 10)})
+}
+
+func userExport(ctx context.Context, repo repository.UserRepository, w *csv.Writer) (int, error) {
+	header := []string{"id", "created_at", "username", "email", "mobile", "address", "gender", "sports", "dob", "country"}
+	if err := w.Write(header); err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	for page := 1; ; page++ {
+		users, _, err := repo.List(ctx, model.UserFilter{}, page, exportPageSize, "_id", "asc")
+		if err != nil {
+			return 0, err
+		}
+		for _, u := range users {
+			record := []string{
+				u.ID.Hex(),
+				u.ID.Timestamp().UTC().Format(time.RFC3339),
+				u.Username, u.Email, u.Mobile, u.Address, u.Gender, u.Sports, u.DOB, u.Country,
+			}
+			for i := range record {
+				record[i] = safeCell(record[i])
+			}
+			if err := w.Write(record); err != nil {
+				return 0, err
+			}
+			rows++
+		}
+		if len(users) < exportPageSize {
+			return rows, nil
+		}
+	}
+}
+
+var plainNumber = regexp.MustCompile(`^[+-]?[0-9]+$`)
+
+// safeCell stops spreadsheets from running user input as a formula. Phone numbers
+// such as +91... are left alone since they cannot be a formula.
+func safeCell(v string) string {
+	if v == "" || plainNumber.MatchString(v) {
+		return v
+	}
+	switch v[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return "'" + v
+	}
+	return v
+}
@@ -0,0 +1,146 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go2/emails"
+	"go2/mailer"
+	"go2/model"
+	"go2/repository"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Scheduler runs due reports and emails them. Every instance of the app runs one, the
+// lease taken by Claim makes sure a report is only sent by one of them.
+type Scheduler struct {
+	Repos        repository.Repositories
+	Mailer       mailer.Mailer
+	Emails       *emails.Renderer
+	Owner        string // identifies this instance in the lease
+	PollInterval time.Duration
+	Lease        time.Duration // how long a report may take before another instance retries it
+
+	// Larger files are not attached, they are saved and the email links to FileLink+ID.
+	// The outbox stores attachments in its documents, which MongoDB caps at 16MB.
+	MaxAttachment int
+	FileLink      string
+	FileRetention time.Duration // saved files are deleted after this long
+}
+
+func NewScheduler(repos repository.Repositories, m mailer.Mailer, r *emails.Renderer, fileLink string) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		Repos:         repos,
+		Mailer:        m,
+		Emails:        r,
+		Owner:         fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano()),
+		PollInterval:  30 * time.Second,
+		Lease:         10 * time.Minute,
+		MaxAttachment: 5 << 20,
+		FileLink:      fileLink,
+		FileRetention: 30 * 24 * time.Hour,
+	}
+}
+
+// Run polls for due reports until ctx is cancelled, then returns after the current one.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for s.runOne(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOne runs a single due report and reports whether there was one.
+func (s *Scheduler) runOne(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	now := time.Now()
+	schedule, err := s.Repos.Reports.Claim(ctx, now, now.Add(s.Lease), s.Owner)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "reports: failed to claim schedule", "error", err)
+		return false
+	}
+
+	// A report that has started is finished even during shutdown
+	ctx = context.WithoutCancel(ctx)
+	runCtx, cancel := context.WithTimeout(ctx, s.Lease)
+	err = s.send(runCtx, schedule, now)
+	cancel()
+
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+		slog.WarnContext(ctx, "reports: report failed", "schedule_id", schedule.ID.Hex(), "kind", schedule.Kind, "error", err)
+	} else {
+		slog.InfoContext(ctx, "reports: report sent", "schedule_id", schedule.ID.Hex(), "kind", schedule.Kind, "recipients", len(schedule.Recipients))
+	}
+
+	// Runs missed while no instance was up are skipped, not sent one after the other
+	next := NextRun(schedule, now)
+	if err := s.Repos.Reports.Complete(ctx, schedule.ID, s.Owner, now, next, lastError); err != nil {
+		slog.ErrorContext(ctx, "reports: failed to record run", "schedule_id", schedule.ID.Hex(), "error", err)
+	}
+	return true
+}
+
+func (s *Scheduler) send(ctx context.Context, schedule model.ReportSchedule, now time.Time) error {
+	report, err := Generate(ctx, s.Repos, schedule, now)
+	if err != nil {
+		return fmt.Errorf("generating report: %w", err)
+	}
+
+	data := emails.ReportData{
+		Name:        schedule.Name,
+		Description: Describe(schedule.Kind),
+		To:          report.To.Format("2006-01-02 15:04 MST"),
+		Filename:    report.Filename,
+		Rows:        report.Rows,
+	}
+	if !report.From.IsZero() {
+		data.From = report.From.Format("2006-01-02 15:04 MST")
+	}
+
+	var attachments []mailer.Attachment
+	if len(report.Data) <= s.MaxAttachment {
+		attachments = []mailer.Attachment{{
+			Filename:    report.Filename,
+			ContentType: "text/csv; charset=utf-8",
+			Data:        report.Data,
+		}}
+	} else {
+		if err := s.Repos.ReportFiles.DeleteBefore(ctx, now.Add(-s.FileRetention)); err != nil {
+			slog.WarnContext(ctx, "reports: failed to delete old report files", "error", err)
+		}
+		id, err := s.Repos.ReportFiles.Save(ctx, report.Filename, report.Data)
+		if err != nil {
+			return fmt.Errorf("saving report file: %w", err)
+		}
+		data.Link = s.FileLink + id.Hex()
+		data.LinkDays = int(s.FileRetention / (24 * time.Hour))
+	}
+
+	msg, err := s.Emails.Render(emails.Report, emails.DefaultLocale, data)
+	if err != nil {
+		return err
+	}
+	msg.To = schedule.Recipients
+	msg.Attachments = attachments
+	return s.Mailer.Send(ctx, msg)
+}
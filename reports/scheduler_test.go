@@ -0,0 +1,56 @@
+package reports
+
+import (
+	"context"
+	"go2/emails"
+	"go2/mailer"
+	"go2/model"
+	"go2/repository/memory"
+	"go2/templates"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSendLinksLargeReports(t *testing.T) {
+	emailFS, err := fs.Sub(templates.Files, "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos := memory.New("INDIA")
+	ctx := context.Background()
+	if err := repos.Users.Insert(ctx, model.User{Username: "Jane", Email: "jane@example.com", Mobile: "9876543210", Country: "INDIA"}); err != nil {
+		t.Fatal(err)
+	}
+	mem := mailer.NewMemoryMailer()
+	s := NewScheduler(repos, mailer.WithDefaultFrom(mem, "noreply@example.com"), emails.NewRenderer(emailFS), "http://example.com/reports/files/")
+	schedule := model.ReportSchedule{Name: "Export", Kind: model.ReportUserExport, Frequency: model.FrequencyDaily, Recipients: []string{"admin@example.com"}}
+
+	if err := s.send(ctx, schedule, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if msg := mem.Messages()[0]; len(msg.Attachments) != 1 || strings.Contains(msg.Text, "/reports/files/") {
+		t.Fatalf("small report: %d attachments, text %q", len(msg.Attachments), msg.Text)
+	}
+
+	s.MaxAttachment = 10
+	if err := s.send(ctx, schedule, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	msg := mem.Messages()[1]
+	i := strings.Index(msg.Text, "/reports/files/")
+	if len(msg.Attachments) != 0 || i < 0 {
+		t.Fatalf("large report: %d attachments, text %q", len(msg.Attachments), msg.Text)
+	}
+	id, err := primitive.ObjectIDFromHex(msg.Text[i+len("/reports/files/") : i+len("/reports/files/")+24])
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := repos.ReportFiles.Open(ctx, id)
+	if err != nil || !strings.Contains(string(file.Data), "jane@example.com") {
+		t.Errorf("saved file %q, %v", file.Data, err)
+	}
+}
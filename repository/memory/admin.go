@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"context"
+	"go2/model"
+	"go2/repository"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AdminRepository struct {
+	mu     sync.Mutex
+	admins map[primitive.ObjectID]model.Admin
+}
+
+func NewAdminRepository() *AdminRepository {
+	return &AdminRepository{admins: make(map[primitive.ObjectID]model.Admin)}
+}
+
+// Add stores an admin, the MongoDB implementation gets them from seeding instead
+func (r *AdminRepository) Add(admin model.Admin) model.Admin {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if admin.ID.IsZero() {
+		admin.ID = primitive.NewObjectID()
+	}
+	r.admins[admin.ID] = admin
+	return admin
+}
+
+func (r *AdminRepository) FindByID(ctx context.Context, id primitive.ObjectID) (model.Admin, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	admin, ok := r.admins[id]
+	if !ok {
+		return model.Admin{}, repository.ErrNotFound
+	}
+	return admin, nil
+}
+
+func (r *AdminRepository) FindByEmail(ctx context.Context, email string) (model.Admin, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, a := range r.admins {
+		if a.Email == email {
+			return a, nil
+		}
+	}
+	return model.Admin{}, repository.ErrNotFound
+}
+
+func (r *AdminRepository) UpdatePassword(ctx context.Context, id primitive.ObjectID, hashedPassword string, history int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	admin, ok := r.admins[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	admin.PasswordHistory = keepHistory(admin.Password, admin.PasswordHistory, history)
+	admin.Password = hashedPassword
+	r.admins[id] = admin
+	return nil
+}
+
+func (r *AdminRepository) RehashPassword(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	admin, ok := r.admins[id]
+	if !ok || admin.Password != oldHash {
+		return repository.ErrNotFound
+	}
+	admin.Password = newHash
+	r.admins[id] = admin
+	return nil
+}
+
+// keepHistory puts the replaced hash in front of the history and cuts it to history entries
+func keepHistory(old string, previous []string, history int) []string {
+	kept := append([]string{old}, previous...)
+	return kept[:min(history, len(kept))]
+}
@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"context"
+	"go2/analytics"
+	"go2/model"
+	"strings"
+	"time"
+)
+
+// AnalyticsRepository computes the dashboard statistics over the users of a UserRepository
+type AnalyticsRepository struct {
+	users *UserRepository
+}
+
+func NewAnalyticsRepository(users *UserRepository) *AnalyticsRepository {
+	return &AnalyticsRepository{users: users}
+}
+
+func (r *AnalyticsRepository) UserStats(ctx context.Context, f model.StatsFilter) (model.UserStats, error) {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+
+	now := time.Now().UTC()
+	countries := make(map[string]int64)
+	genders := make(map[string]int64)
+	sports := make(map[string]int64)
+	ages := make(map[string]int64)
+	periods := make(map[time.Time]int64)
+
+	var stats model.UserStats
+	for _, u := range r.users.users {
+		created := u.ID.Timestamp()
+		if created.Before(f.From) || !created.Before(f.To) {
+			continue
+		}
+		stats.Total++
+		countries[orNotSet(u.Country)]++
+		genders[orNotSet(u.Gender)]++
+		for _, sport := range strings.Split(u.Sports, ",") {
+			if sport = strings.TrimSpace(sport); sport != "" {
+				sports[sport]++
+			}
+		}
+		ages[analytics.AgeBandOf(u.DOB, now)]++
+		periods[analytics.PeriodStart(created, f.Interval)]++
+	}
+
+	stats.ByCountry = analytics.Counts(countries)
+	stats.ByGender = analytics.Counts(genders)
+	stats.BySport = analytics.Counts(sports)
+	stats.ByAgeBand = analytics.OrderAgeBands(ages)
+	for start, n := range periods {
+		stats.Registrations = append(stats.Registrations, model.PeriodCount{Start: start, Count: n})
+	}
+	return stats, nil
+}
+
+func orNotSet(value string) string {
+	if value == "" {
+		return analytics.NotSet
+	}
+	return value
+}
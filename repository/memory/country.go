@@ -0,0 +1,21 @@
+package memory
+
+import (
+	"context"
+	"sync"
+)
+
+type CountryRepository struct {
+	mu        sync.Mutex
+	countries []string
+}
+
+func NewCountryRepository(countries ...string) *CountryRepository {
+	return &CountryRepository{countries: countries}
+}
+
+func (r *CountryRepository) List(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.countries...), nil
+}
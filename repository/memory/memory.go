@@ -0,0 +1,38 @@
+// Package memory implements the repository interfaces with maps guarded by a mutex.
+// It behaves like the MongoDB implementation, including unique fields and token expiry,
+// so handlers can be exercised with httptest and no database.
+package memory
+
+import (
+	"go2/repository"
+)
+
+// New returns empty repositories with the given countries.
+func New(countries ...string) repository.Repositories {
+	users := NewUserRepository()
+	return repository.Repositories{
+		Users:       users,
+		Admins:      NewAdminRepository(),
+		Tokens:      NewTokenRepository(),
+		Countries:   NewCountryRepository(countries...),
+		Outbox:      NewOutboxRepository(),
+		Analytics:   NewAnalyticsRepository(users),
+		Reports:     NewReportRepository(),
+		ReportFiles: NewReportFileRepository(),
+		Webhooks:    NewWebhookRepository(),
+		Deliveries:  NewDeliveryRepository(),
+	}
+}
+
+var (
+	_ repository.UserRepository       = (*UserRepository)(nil)
+	_ repository.AdminRepository      = (*AdminRepository)(nil)
+	_ repository.TokenRepository      = (*TokenRepository)(nil)
+	_ repository.CountryRepository    = (*CountryRepository)(nil)
+	_ repository.OutboxRepository     = (*OutboxRepository)(nil)
+	_ repository.AnalyticsRepository  = (*AnalyticsRepository)(nil)
+	_ repository.ReportRepository     = (*ReportRepository)(nil)
+	_ repository.ReportFileRepository = (*ReportFileRepository)(nil)
+	_ repository.WebhookRepository    = (*WebhookRepository)(nil)
+	_ repository.DeliveryRepository   = (*DeliveryRepository)(nil)
+)
@@ -0,0 +1,129 @@
+package memory
+
+import (
+	"context"
+	"go2/model"
+	"go2/repository"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OutboxRepository struct {
+	mu     sync.Mutex
+	emails map[primitive.ObjectID]model.OutboxEmail
+}
+
+func NewOutboxRepository() *OutboxRepository {
+	return &OutboxRepository{emails: make(map[primitive.ObjectID]model.OutboxEmail)}
+}
+
+func (r *OutboxRepository) Insert(ctx context.Context, email model.OutboxEmail) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if email.ID.IsZero() {
+		email.ID = primitive.NewObjectID()
+	}
+	r.emails[email.ID] = email
+	return nil
+}
+
+func (r *OutboxRepository) Claim(ctx context.Context, now, leaseUntil time.Time) (model.OutboxEmail, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []model.OutboxEmail
+	for _, e := range r.emails {
+		pending := e.Status == model.OutboxPending && !e.NextAttemptAt.After(now)
+		abandoned := e.Status == model.OutboxSending && e.LockedUntil.Before(now)
+		if pending || abandoned {
+			due = append(due, e)
+		}
+	}
+	if len(due) == 0 {
+		return model.OutboxEmail{}, repository.ErrNotFound
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	email := due[0]
+	email.Status = model.OutboxSending
+	email.LockedUntil = leaseUntil
+	r.emails[email.ID] = email
+	return email, nil
+}
+
+// MarkSent records the delivery and drops the body and attachments, like the Mongo outbox
+func (r *OutboxRepository) MarkSent(ctx context.Context, id primitive.ObjectID, attempts int) error {
+	return r.update(id, func(e *model.OutboxEmail) {
+		e.Status = model.OutboxSent
+		e.Attempts = attempts
+		e.SentAt = time.Now()
+		e.FinishedAt = e.SentAt
+		e.LockedUntil = time.Time{}
+		e.LastError = ""
+		e.HTML, e.Text, e.Attachments = "", "", nil
+	})
+}
+
+func (r *OutboxRepository) MarkFailed(ctx context.Context, id primitive.ObjectID, status string, attempts int, nextAttemptAt time.Time, lastError string) error {
+	return r.update(id, func(e *model.OutboxEmail) {
+		e.Status = status
+		e.Attempts = attempts
+		e.NextAttemptAt = nextAttemptAt
+		e.LastError = lastError
+		e.LockedUntil = time.Time{}
+		if status == model.OutboxDead {
+			e.FinishedAt = time.Now()
+		}
+	})
+}
+
+func (r *OutboxRepository) ListFailed(ctx context.Context, limit int) ([]model.OutboxEmail, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var failed []model.OutboxEmail
+	for _, e := range r.emails {
+		if e.Status == model.OutboxDead || (e.Status == model.OutboxPending && e.Attempts > 0) {
+			failed = append(failed, e)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].CreatedAt.After(failed[j].CreatedAt) })
+	if len(failed) > limit {
+		failed = failed[:limit]
+	}
+	return failed, nil
+}
+
+func (r *OutboxRepository) Resend(ctx context.Context, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.emails[id]
+	if !ok || (e.Status != model.OutboxDead && e.Status != model.OutboxPending) {
+		return repository.ErrNotFound
+	}
+	e.Status = model.OutboxPending
+	e.Attempts = 0
+	e.NextAttemptAt = time.Now()
+	e.LastError = ""
+	e.FinishedAt = time.Time{}
+	r.emails[id] = e
+	return nil
+}
+
+func (r *OutboxRepository) update(id primitive.ObjectID, apply func(*model.OutboxEmail)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.emails[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	apply(&e)
+	r.emails[id] = e
+	return nil
+}
@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"context"
+	"go2/model"
+	"go2/repository"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ReportRepository struct {
+	mu        sync.Mutex
+	schedules map[primitive.ObjectID]model.ReportSchedule
+}
+
+func NewReportRepository() *ReportRepository {
+	return &ReportRepository{schedules: make(map[primitive.ObjectID]model.ReportSchedule)}
+}
+
+func (r *ReportRepository) Insert(ctx context.Context, schedule model.ReportSchedule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if schedule.ID.IsZero() {
+		schedule.ID = primitive.NewObjectID()
+	}
+	r.schedules[schedule.ID] = schedule
+	return nil
+}
+
+func (r *ReportRepository) List(ctx context.Context) ([]model.ReportSchedule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	schedules := make([]model.ReportSchedule, 0, len(r.schedules))
+	for _, s := range r.schedules {
+		schedules = append(schedules, s)
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].Name < schedules[j].Name })
+	return schedules, nil
+}
+
+func (r *ReportRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.schedules[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.schedules, id)
+	return nil
+}
+
+func (r *ReportRepository) RunNow(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	return r.update(id, func(s *model.ReportSchedule) bool {
+		s.NextRunAt = now
+		return true
+	})
+}
+
+func (r *ReportRepository) Claim(ctx context.Context, now, leaseUntil time.Time, owner string) (model.ReportSchedule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []model.ReportSchedule
+	for _, s := range r.schedules {
+		if !s.NextRunAt.After(now) && s.LockedUntil.Before(now) {
+			due = append(due, s)
+		}
+	}
+	if len(due) == 0 {
+		return model.ReportSchedule{}, repository.ErrNotFound
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].NextRunAt.Before(due[j].NextRunAt) })
+	schedule := due[0]
+	schedule.LockedUntil = leaseUntil
+	schedule.LockedBy = owner
+	r.schedules[schedule.ID] = schedule
+	return schedule, nil
+}
+
+func (r *ReportRepository) Complete(ctx context.Context, id primitive.ObjectID, owner string, lastRunAt, nextRunAt time.Time, lastError string) error {
+	return r.update(id, func(s *model.ReportSchedule) bool {
+		if s.LockedBy != owner {
+			return false
+		}
+		s.LastRunAt = lastRunAt
+		s.NextRunAt = nextRunAt
+		s.LastError = lastError
+		s.LockedUntil = time.Time{}
+		s.LockedBy = ""
+		return true
+	})
+}
+
+// update applies fn to the schedule, fn returns false to leave it unchanged and report ErrNotFound
+func (r *ReportRepository) update(id primitive.ObjectID, fn func(*model.ReportSchedule) bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.schedules[id]
+	if !ok || !fn(&s) {
+		return repository.ErrNotFound
+	}
+	r.schedules[id] = s
+	return nil
+}
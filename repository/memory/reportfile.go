@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"context"
+	"go2/model"
+	"go2/repository"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ReportFileRepository struct {
+	mu    sync.Mutex
+	files map[primitive.ObjectID]model.ReportFile
+}
+
+func NewReportFileRepository() *ReportFileRepository {
+	return &ReportFileRepository{files: make(map[primitive.ObjectID]model.ReportFile)}
+}
+
+func (r *ReportFileRepository) Save(ctx context.Context, filename string, data []byte) (primitive.ObjectID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file := model.ReportFile{
+		ID:        primitive.NewObjectID(),
+		Filename:  filename,
+		Data:      append([]byte(nil), data...),
+		CreatedAt: time.Now(),
+	}
+	r.files[file.ID] = file
+	return file.ID, nil
+}
+
+func (r *ReportFileRepository) Open(ctx context.Context, id primitive.ObjectID) (model.ReportFile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file, ok := r.files[id]
+	if !ok {
+		return model.ReportFile{}, repository.ErrNotFound
+	}
+	return file, nil
+}
+
+func (r *ReportFileRepository) DeleteBefore(ctx context.Context, t time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, file := range r.files {
+		if file.CreatedAt.Before(t) {
+			delete(r.files, id)
+		}
+	}
+	return nil
+}
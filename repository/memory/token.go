@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"context"
+	"go2/model"
+	"go2/repository"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]model.Token // token hash -> token
+}
+
+func NewTokenRepository() *TokenRepository {
+	return &TokenRepository{tokens: make(map[string]model.Token)}
+}
+
+func (r *TokenRepository) Issue(ctx context.Context, userID primitive.ObjectID, purpose, tokenHash string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deleteByUser(userID, purpose)
+	r.tokens[tokenHash] = model.Token{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	return nil
+}
+
+func (r *TokenRepository) Find(ctx context.Context, purpose, tokenHash string) (model.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.active(purpose, tokenHash)
+}
+
+func (r *TokenRepository) Consume(ctx context.Context, purpose, tokenHash string) (model.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, err := r.active(purpose, tokenHash)
+	if err != nil {
+		return token, err
+	}
+	delete(r.tokens, tokenHash)
+	return token, nil
+}
+
+func (r *TokenRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID, purpose string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deleteByUser(userID, purpose)
+	return nil
+}
+
+func (r *TokenRepository) active(purpose, tokenHash string) (model.Token, error) {
+	token, ok := r.tokens[tokenHash]
+	if !ok || token.Purpose != purpose || !token.ExpiresAt.After(time.Now()) {
+		return model.Token{}, repository.ErrNotFound
+	}
+	return token, nil
+}
+
+func (r *TokenRepository) deleteByUser(userID primitive.ObjectID, purpose string) {
+	for hash, t := range r.tokens {
+		if t.UserID == userID && t.Purpose == purpose {
+			delete(r.tokens, hash)
+		}
+	}
+}
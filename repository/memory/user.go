@@ -0,0 +1,221 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"go2/model"
+	"go2/repository"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type UserRepository struct {
+	mu    sync.Mutex
+	users map[primitive.ObjectID]model.User
+}
+
+func NewUserRepository() *UserRepository {
+	return &UserRepository{users: make(map[primitive.ObjectID]model.User)}
+}
+
+func (r *UserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.findBy(func(u model.User) bool { return u.Email == email }), nil
+}
+
+func (r *UserRepository) MobileExists(ctx context.Context, mobile string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.findBy(func(u model.User) bool { return u.Mobile == mobile }), nil
+}
+
+func (r *UserRepository) Insert(ctx context.Context, user model.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkUnique(user); err != nil {
+		return err
+	}
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	r.users[user.ID] = user
+	return nil
+}
+
+func (r *UserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return model.User{}, repository.ErrNotFound
+	}
+	return user, nil
+}
+
+func (r *UserRepository) Update(ctx context.Context, user model.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[user.ID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if err := r.checkUnique(user); err != nil {
+		return err
+	}
+
+	stored.Username = user.Username
+	stored.Email = user.Email
+	stored.EmailVerified = user.EmailVerified
+	stored.Mobile = user.Mobile
+	stored.Address = user.Address
+	stored.Gender = user.Gender
+	stored.Sports = user.Sports
+	stored.DOB = user.DOB
+	stored.Country = user.Country
+	stored.Image = user.Image
+	r.users[user.ID] = stored
+	return nil
+}
+
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return model.User{}, repository.ErrNotFound
+}
+
+func (r *UserRepository) UpdatePassword(ctx context.Context, id primitive.ObjectID, hashedPassword string, history int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	u.PasswordHistory = keepHistory(u.Password, u.PasswordHistory, history)
+	u.Password = hashedPassword
+	r.users[id] = u
+	return nil
+}
+
+func (r *UserRepository) RehashPassword(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok || u.Password != oldHash {
+		return repository.ErrNotFound
+	}
+	u.Password = newHash
+	r.users[id] = u
+	return nil
+}
+
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	u.EmailVerified = true
+	r.users[id] = u
+	return nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.users, id)
+	return nil
+}
+
+func (r *UserRepository) List(ctx context.Context, filter model.UserFilter, page, limit int, sortField, sortOrder string) ([]model.User, int64, error) {
+	// MongoDB refuses a negative skip, the offset is checked before it is computed so it cannot overflow
+	if page < 1 || limit < 1 || page-1 > math.MaxInt/limit {
+		return nil, 0, fmt.Errorf("invalid page %d with limit %d", page, limit)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := make([]model.User, 0, len(r.users))
+	for _, u := range r.users {
+		switch {
+		case filter.Verified == model.FilterVerified && !u.EmailVerified:
+			continue
+		case filter.Verified == model.FilterUnverified && u.EmailVerified:
+			continue
+		}
+		users = append(users, u)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		c := compareUsers(users[i], users[j], sortField)
+		if sortOrder == "asc" {
+			return c < 0
+		}
+		return c > 0
+	})
+
+	total := int64(len(users))
+	start := min((page-1)*limit, len(users))
+	end := min(start+limit, len(users))
+	return users[start:end], total, nil
+}
+
+// checkUnique mirrors the unique indexes on email and mobile, ignoring the user itself
+func (r *UserRepository) checkUnique(user model.User) error {
+	for id, u := range r.users {
+		if id == user.ID {
+			continue
+		}
+		if u.Email == user.Email {
+			return &repository.DuplicateError{Field: "email"}
+		}
+		if u.Mobile == user.Mobile {
+			return &repository.DuplicateError{Field: "mobile"}
+		}
+	}
+	return nil
+}
+
+func (r *UserRepository) findBy(match func(model.User) bool) bool {
+	for _, u := range r.users {
+		if match(u) {
+			return true
+		}
+	}
+	return false
+}
+
+func compareUsers(a, b model.User, field string) int {
+	switch field {
+	case "username":
+		return strings.Compare(a.Username, b.Username)
+	case "email":
+		return strings.Compare(a.Email, b.Email)
+	case "mobile":
+		return strings.Compare(a.Mobile, b.Mobile)
+	default:
+		return strings.Compare(a.ID.Hex(), b.ID.Hex())
+	}
+}
@@ -0,0 +1,194 @@
+package memory
+
+import (
+	"context"
+	"go2/model"
+	"go2/repository"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WebhookRepository struct {
+	mu       sync.Mutex
+	webhooks map[primitive.ObjectID]model.Webhook
+}
+
+func NewWebhookRepository() *WebhookRepository {
+	return &WebhookRepository{webhooks: make(map[primitive.ObjectID]model.Webhook)}
+}
+
+func (r *WebhookRepository) Insert(ctx context.Context, webhook model.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if webhook.ID.IsZero() {
+		webhook.ID = primitive.NewObjectID()
+	}
+	r.webhooks[webhook.ID] = webhook
+	return nil
+}
+
+func (r *WebhookRepository) FindByID(ctx context.Context, id primitive.ObjectID) (model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.webhooks[id]
+	if !ok {
+		return model.Webhook{}, repository.ErrNotFound
+	}
+	return w, nil
+}
+
+func (r *WebhookRepository) List(ctx context.Context) ([]model.Webhook, error) {
+	return r.find(func(model.Webhook) bool { return true }), nil
+}
+
+func (r *WebhookRepository) ListForEvent(ctx context.Context, event string) ([]model.Webhook, error) {
+	return r.find(func(w model.Webhook) bool {
+		for _, e := range w.Events {
+			if e == event {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (r *WebhookRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.webhooks[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.webhooks, id)
+	return nil
+}
+
+func (r *WebhookRepository) find(match func(model.Webhook) bool) []model.Webhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []model.Webhook
+	for _, w := range r.webhooks {
+		if match(w) {
+			out = append(out, w)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+type DeliveryRepository struct {
+	mu         sync.Mutex
+	deliveries map[primitive.ObjectID]model.WebhookDelivery
+}
+
+func NewDeliveryRepository() *DeliveryRepository {
+	return &DeliveryRepository{deliveries: make(map[primitive.ObjectID]model.WebhookDelivery)}
+}
+
+func (r *DeliveryRepository) Insert(ctx context.Context, delivery model.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if delivery.ID.IsZero() {
+		delivery.ID = primitive.NewObjectID()
+	}
+	r.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (r *DeliveryRepository) Claim(ctx context.Context, now, leaseUntil time.Time) (model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []model.WebhookDelivery
+	for _, d := range r.deliveries {
+		pending := d.Status == model.DeliveryPending && !d.NextAttemptAt.After(now)
+		abandoned := d.Status == model.DeliverySending && d.LockedUntil.Before(now)
+		if pending || abandoned {
+			due = append(due, d)
+		}
+	}
+	if len(due) == 0 {
+		return model.WebhookDelivery{}, repository.ErrNotFound
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	delivery := due[0]
+	delivery.Status = model.DeliverySending
+	delivery.LockedUntil = leaseUntil
+	r.deliveries[delivery.ID] = delivery
+	return delivery, nil
+}
+
+func (r *DeliveryRepository) MarkDelivered(ctx context.Context, id primitive.ObjectID, attempts, responseCode int) error {
+	return r.update(id, func(d *model.WebhookDelivery) bool {
+		d.Status = model.DeliveryDelivered
+		d.Attempts = attempts
+		d.ResponseCode = responseCode
+		d.DeliveredAt = time.Now()
+		d.LockedUntil = time.Time{}
+		d.LastError = ""
+		return true
+	})
+}
+
+func (r *DeliveryRepository) MarkFailed(ctx context.Context, id primitive.ObjectID, status string, attempts, responseCode int, nextAttemptAt time.Time, lastError string) error {
+	return r.update(id, func(d *model.WebhookDelivery) bool {
+		d.Status = status
+		d.Attempts = attempts
+		d.ResponseCode = responseCode
+		d.NextAttemptAt = nextAttemptAt
+		d.LastError = lastError
+		d.LockedUntil = time.Time{}
+		return true
+	})
+}
+
+func (r *DeliveryRepository) List(ctx context.Context, webhookID primitive.ObjectID, limit int) ([]model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []model.WebhookDelivery
+	for _, d := range r.deliveries {
+		if webhookID.IsZero() || d.WebhookID == webhookID {
+			out = append(out, d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (r *DeliveryRepository) Redeliver(ctx context.Context, id primitive.ObjectID) error {
+	return r.update(id, func(d *model.WebhookDelivery) bool {
+		if d.Status != model.DeliveryDelivered && d.Status != model.DeliveryDead {
+			return false
+		}
+		d.Status = model.DeliveryPending
+		d.Attempts = 0
+		d.NextAttemptAt = time.Now()
+		d.LastError = ""
+		return true
+	})
+}
+
+// update applies fn to the delivery, fn returns false to leave it unchanged and report ErrNotFound
+func (r *DeliveryRepository) update(id primitive.ObjectID, fn func(*model.WebhookDelivery) bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.deliveries[id]
+	if !ok || !fn(&d) {
+		return repository.ErrNotFound
+	}
+	r.deliveries[id] = d
+	return nil
+}
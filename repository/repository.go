@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go2/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNotFound is returned when a lookup matches nothing.
+var ErrNotFound = errors.New("not found")
+
+// DuplicateError is returned when a unique field already holds the value.
+type DuplicateError struct {
+	Field string // form field name, e.g. "email"
+}
+
+func (e *DuplicateError) Error() string {
+	return "duplicate value for " + e.Field
+}
+
+// DuplicateField returns the field behind a DuplicateError, or "" for any other error.
+func DuplicateField(err error) string {
+	var dup *DuplicateError
+	if errors.As(err, &dup) {
+		return dup.Field
+	}
+	return ""
+}
+
+type UserRepository interface {
+	EmailExists(ctx context.Context, email string) (bool, error)
+	MobileExists(ctx context.Context, mobile string) (bool, error)
+	Insert(ctx context.Context, user model.User) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (model.User, error)
+	FindByEmail(ctx context.Context, email string) (model.User, error)
+	// Update saves the editable profile fields, the email with its verification flag and the
+	// image, a nil image removes it
+	Update(ctx context.Context, user model.User) error
+	// UpdatePassword replaces the password and moves the old hash to the front of the history,
+	// which is cut to the newest history hashes
+	UpdatePassword(ctx context.Context, id primitive.ObjectID, hashedPassword string, history int) error
+	// RehashPassword swaps the hash of an unchanged password for a stronger one. It only applies
+	// while the stored hash is still oldHash, ErrNotFound otherwise, and leaves the history alone.
+	RehashPassword(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error
+	// MarkEmailVerified sets the verification flag, ErrNotFound if the user is gone
+	MarkEmailVerified(ctx context.Context, id primitive.ObjectID) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// List returns one page of the matching users sorted by sortField ("_id", "username", "email"
+	// or "mobile") and their total count
+	List(ctx context.Context, filter model.UserFilter, page, limit int, sortField, sortOrder string) ([]model.User, int64, error)
+}
+
+type AdminRepository interface {
+	FindByID(ctx context.Context, id primitive.ObjectID) (model.Admin, error)
+	FindByEmail(ctx context.Context, email string) (model.Admin, error)
+	// UpdatePassword keeps the password history like UserRepository.UpdatePassword
+	UpdatePassword(ctx context.Context, id primitive.ObjectID, hashedPassword string, history int) error
+	// RehashPassword works like UserRepository.RehashPassword
+	RehashPassword(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error
+}
+
+type TokenRepository interface {
+	// Issue replaces any older token for the same user and purpose
+	Issue(ctx context.Context, userID primitive.ObjectID, purpose, tokenHash string, expiresAt time.Time) error
+	// Find returns an unexpired token without using it up
+	Find(ctx context.Context, purpose, tokenHash string) (model.Token, error)
+	// Consume deletes and returns an unexpired token in one step
+	Consume(ctx context.Context, purpose, tokenHash string) (model.Token, error)
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID, purpose string) error
+}
+
+type CountryRepository interface {
+	List(ctx context.Context) ([]string, error)
+}
+
+type OutboxRepository interface {
+	Insert(ctx context.Context, email model.OutboxEmail) error
+	// Claim leases the next due message, or returns ErrNotFound when nothing is due
+	Claim(ctx context.Context, now, leaseUntil time.Time) (model.OutboxEmail, error)
+	MarkSent(ctx context.Context, id primitive.ObjectID, attempts int) error
+	MarkFailed(ctx context.Context, id primitive.ObjectID, status string, attempts int, nextAttemptAt time.Time, lastError string) error
+	ListFailed(ctx context.Context, limit int) ([]model.OutboxEmail, error)
+	// Resend queues a failed message again, ErrNotFound if it is not failed
+	Resend(ctx context.Context, id primitive.ObjectID) error
+}
+
+// AnalyticsRepository computes the statistics shown on the dashboard
+type AnalyticsRepository interface {
+	UserStats(ctx context.Context, filter model.StatsFilter) (model.UserStats, error)
+}
+
+// ReportRepository stores report schedules, Claim and Complete make sure only one
+// instance runs a due report
+type ReportRepository interface {
+	Insert(ctx context.Context, schedule model.ReportSchedule) error
+	List(ctx context.Context) ([]model.ReportSchedule, error)
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// RunNow makes a schedule due at the given time
+	RunNow(ctx context.Context, id primitive.ObjectID, now time.Time) error
+	// Claim leases the next due schedule to owner, or returns ErrNotFound when nothing is due
+	Claim(ctx context.Context, now, leaseUntil time.Time, owner string) (model.ReportSchedule, error)
+	// Complete records a run and releases the lease, ErrNotFound if owner no longer holds it
+	Complete(ctx context.Context, id primitive.ObjectID, owner string, lastRunAt, nextRunAt time.Time, lastError string) error
+}
+
+// ReportFileRepository keeps the reports that are too large to send as an attachment
+type ReportFileRepository interface {
+	Save(ctx context.Context, filename string, data []byte) (primitive.ObjectID, error)
+	Open(ctx context.Context, id primitive.ObjectID) (model.ReportFile, error)
+	// DeleteBefore removes the files saved before t
+	DeleteBefore(ctx context.Context, t time.Time) error
+}
+
+type WebhookRepository interface {
+	Insert(ctx context.Context, webhook model.Webhook) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (model.Webhook, error)
+	List(ctx context.Context) ([]model.Webhook, error)
+	// ListForEvent returns the endpoints subscribed to event
+	ListForEvent(ctx context.Context, event string) ([]model.Webhook, error)
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+type DeliveryRepository interface {
+	Insert(ctx context.Context, delivery model.WebhookDelivery) error
+	// Claim leases the next due delivery, or returns ErrNotFound when nothing is due
+	Claim(ctx context.Context, now, leaseUntil time.Time) (model.WebhookDelivery, error)
+	MarkDelivered(ctx context.Context, id primitive.ObjectID, attempts, responseCode int) error
+	MarkFailed(ctx context.Context, id primitive.ObjectID, status string, attempts, responseCode int, nextAttemptAt time.Time, lastError string) error
+	// List returns the newest deliveries, of one endpoint when webhookID is not zero
+	List(ctx context.Context, webhookID primitive.ObjectID, limit int) ([]model.WebhookDelivery, error)
+	// Redeliver queues a finished delivery again, ErrNotFound if it is still in the queue
+	Redeliver(ctx context.Context, id primitive.ObjectID) error
+}
+
+// Repositories bundles every repository the app needs, one value per storage backend.
+type Repositories struct {
+	Users       UserRepository
+	Admins      AdminRepository
+	Tokens      TokenRepository
+	Countries   CountryRepository
+	Outbox      OutboxRepository
+	Analytics   AnalyticsRepository
+	Reports     ReportRepository
+	ReportFiles ReportFileRepository
+	Webhooks    WebhookRepository
+	Deliveries  DeliveryRepository
+}
@@ -0,0 +1,141 @@
+// Package router wraps http.ServeMux with route groups and middleware chains. Patterns use the
+// Go 1.22 syntax, e.g. "GET /users/{id}", so the mux itself answers 405 for a wrong method.
+package router
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Middleware wraps a handler, e.g. to check the session or recover from panics
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h so that the first middleware is the outermost one
+func Chain(h http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// Router registers routes on a shared ServeMux. The root router's middleware wraps every
+// request, including the ones no route matches. A group's middleware only wraps its own routes.
+type Router struct {
+	mux        *http.ServeMux
+	prefix     string
+	middleware []Middleware
+	root       *Router
+
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+}
+
+func New() *Router {
+	r := &Router{mux: http.NewServeMux()}
+	r.root = r
+	return r
+}
+
+// Use appends middleware to the router or group
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// Group returns a router whose routes are registered under prefix and wrapped in the given
+// middleware, after the middleware of the enclosing group.
+func (r *Router) Group(prefix string, middleware ...Middleware) *Router {
+	g := &Router{
+		mux:    r.mux,
+		prefix: r.prefix + strings.TrimRight(prefix, "/"),
+		root:   r.root,
+	}
+	if r != r.root {
+		g.middleware = append(g.middleware, r.middleware...)
+	}
+	g.middleware = append(g.middleware, middleware...)
+	return g
+}
+
+// Handle registers h for a pattern such as "GET /users/{id}" or "/static/"
+func (r *Router) Handle(pattern string, h http.Handler) {
+	method, path := "", pattern
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		method, path = pattern[:i+1], strings.TrimLeft(pattern[i+1:], " ")
+	}
+	if r != r.root {
+		h = Chain(h, r.middleware...)
+	}
+	r.mux.Handle(method+r.prefix+path, h)
+}
+
+func (r *Router) HandleFunc(pattern string, h http.HandlerFunc) {
+	r.Handle(pattern, h)
+}
+
+func (r *Router) Get(path string, h http.HandlerFunc) {
+	r.Handle(http.MethodGet+" "+path, h)
+}
+
+func (r *Router) Post(path string, h http.HandlerFunc) {
+	r.Handle(http.MethodPost+" "+path, h)
+}
+
+// NotFound replaces the plain text 404 of the mux
+func (r *Router) NotFound(h http.Handler) {
+	r.root.notFound = h
+}
+
+// MethodNotAllowed replaces the plain text 405 of the mux, the Allow header is already set
+func (r *Router) MethodNotAllowed(h http.Handler) {
+	r.root.methodNotAllowed = h
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	root := r.root
+	Chain(http.HandlerFunc(root.dispatch), root.middleware...).ServeHTTP(w, req)
+}
+
+func (r *Router) dispatch(w http.ResponseWriter, req *http.Request) {
+	// An empty pattern means the mux is about to answer 404 or 405 itself
+	if _, pattern := r.mux.Handler(req); pattern == "" && (r.notFound != nil || r.methodNotAllowed != nil) {
+		w = &errorInterceptor{ResponseWriter: w, req: req, router: r}
+	}
+	r.mux.ServeHTTP(w, req)
+}
+
+// errorInterceptor swaps the mux's own 404 and 405 responses for the configured handlers
+type errorInterceptor struct {
+	http.ResponseWriter
+	req     *http.Request
+	router  *Router
+	handled bool
+}
+
+func (e *errorInterceptor) WriteHeader(code int) {
+	var h http.Handler
+	switch code {
+	case http.StatusNotFound:
+		h = e.router.notFound
+	case http.StatusMethodNotAllowed:
+		h = e.router.methodNotAllowed
+	}
+	if h == nil {
+		e.ResponseWriter.WriteHeader(code)
+		return
+	}
+	e.handled = true
+	e.Header().Del("Content-Type")
+	e.Header().Del("X-Content-Type-Options")
+	h.ServeHTTP(e.ResponseWriter, e.req)
+}
+
+func (e *errorInterceptor) Write(b []byte) (int, error) {
+	if e.handled {
+		return len(b), nil
+	}
+	return e.ResponseWriter.Write(b)
+}
+
+func (e *errorInterceptor) Unwrap() http.ResponseWriter {
+	return e.ResponseWriter
+}
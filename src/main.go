@@ -1,33 +1,249 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"go2/config"
+	"go2/emails"
+	"go2/events"
+	"go2/flash"
 	"go2/handler"
+	"go2/logging"
+	"go2/mailer"
+	"go2/metrics"
 	"go2/mongo"
+	"go2/outbox"
+	"go2/passhash"
+	"go2/passpolicy"
+	"go2/render"
+	"go2/reports"
+	"go2/static"
+	"go2/templates"
+	"go2/webhooks"
+	"io/fs"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 func main() {
-	// Run this single time
-	// mongo.Connect()
-
-	handler.InitSession()
-	mongo.InitMongoData()
-	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
-
-	http.HandleFunc("/", handler.LoginHandler)
-	http.HandleFunc("/forgot", handler.ForgotPasswordHandler)
-	http.HandleFunc("/reset", handler.ResetHandler)
-	http.HandleFunc("/logout", handler.LogoutHandler)
-
-	// Protected routes
-	http.HandleFunc("/home", handler.RequireLogin(handler.HomeHandler))
-	http.HandleFunc("/edit", handler.RequireLogin(handler.EditHandler))
-	http.HandleFunc("/register", handler.RequireLogin(handler.RegisterHandler))
-	http.HandleFunc("/update", handler.RequireLogin(handler.UpdateHandler))
-	http.HandleFunc("/delete", handler.RequireLogin(handler.DeleteHandler))
-
-	fmt.Println("Application running on http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "optional YAML or TOML config file")
+	migrateResetTokens := flag.Bool("migrate-legacy-reset-tokens", false,
+		"drop the reset token collection of older versions and exit, run once after upgrading")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.Log)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	// SIGINT or SIGTERM cancels ctx and starts the shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *migrateResetTokens {
+		if err := migrateLegacyResetTokens(ctx, cfg); err != nil {
+			slog.Error("migration failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := run(ctx, cfg); err != nil {
+		slog.Error("application failed", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("application stopped")
+}
+
+// migrateLegacyResetTokens connects to MongoDB only to run the one-off reset token migration
+func migrateLegacyResetTokens(ctx context.Context, cfg config.Config) error {
+	store, err := mongo.Connect(ctx, cfg.Mongo)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+		defer cancel()
+		if err := store.Close(closeCtx); err != nil {
+			slog.Error("failed to disconnect MongoDB", "error", err)
+		}
+	}()
+	return store.MigrateLegacyResetTokens(ctx)
+}
+
+// run starts everything, blocks until ctx is cancelled or the server fails, and then shuts down
+// in order: stop accepting requests and drain them, stop the workers, disconnect MongoDB.
+func run(ctx context.Context, cfg config.Config) error {
+	// Templates and static files are embedded, dev mode reads them from disk instead
+	var templateFS, staticFS fs.FS = templates.Files, static.Files
+	if cfg.App.DevMode {
+		templateFS, staticFS = os.DirFS("templates"), os.DirFS("static")
+	}
+	assets, err := static.New(staticFS, !cfg.App.DevMode)
+	if err != nil {
+		return fmt.Errorf("failed to read static files: %w", err)
+	}
+	render.StaticURL = assets.URL
+	if err := render.Load(templateFS); err != nil {
+		return fmt.Errorf("failed to parse templates: %w", err)
+	}
+	emailFS, err := fs.Sub(templateFS, "email")
+	if err != nil {
+		return err
+	}
+
+	if cfg.App.SecretKey != "" {
+		flash.SetKey([]byte(cfg.App.SecretKey))
+	} else {
+		slog.Warn("APP_SECRET_KEY not set, flash messages do not survive a restart")
+	}
+
+	store, err := mongo.Connect(ctx, cfg.Mongo, metrics.CommandMonitor(), logging.CommandMonitor())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+		defer cancel()
+		if err := store.Close(closeCtx); err != nil {
+			slog.Error("failed to disconnect MongoDB", "error", err)
+		} else {
+			slog.Info("disconnected from MongoDB")
+		}
+	}()
+
+	repos := store.Repositories()
+
+	m, err := mailer.New(cfg.Mail)
+	if err != nil {
+		return fmt.Errorf("failed to set up mailer: %w", err)
+	}
+
+	// Handlers and reports only queue mail, the worker delivers it with retries
+	queue := outbox.NewQueue(repos.Outbox)
+	emailRenderer := emails.NewRenderer(emailFS)
+	hasher := passhash.New(cfg.Password)
+	h := handler.New(repos, queue, emailRenderer, passpolicy.New(cfg.Password), hasher, cfg.App)
+
+	metrics.RegisterSessionGauge(handler.SessionCount)
+	metrics.RegisterStreamGauge(h.StreamCount)
+
+	// Readiness stays false until schema setup and seeding have finished
+	var startupDone atomic.Bool
+	health := handler.NewHealth(
+		handler.Check{Name: "mongo", Run: store.Ping},
+		handler.Check{Name: "indexes", Run: store.CheckIndexes},
+		handler.Check{Name: "mailer", Run: func(ctx context.Context) error {
+			if cfg.Mail.From == "" {
+				return errors.New("no sender address configured")
+			}
+			return nil
+		}},
+		handler.Check{Name: "startup", Run: func(ctx context.Context) error {
+			if !startupDone.Load() {
+				return errors.New("schema setup and seeding still running")
+			}
+			return nil
+		}},
+	)
+
+	// Background workers get their own context so they outlive the request drain
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		outbox.NewWorker(repos.Outbox, m).Run(workerCtx)
+	}()
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		reports.NewScheduler(repos, queue, emailRenderer, cfg.App.ReportLink).Run(workerCtx)
+	}()
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		webhooks.NewWorker(repos.Webhooks, repos.Deliveries).Run(workerCtx)
+	}()
+	if cfg.Mongo.ChangeStream {
+		bus := events.NewBus()
+		bus.Subscribe("audit", events.Audit)
+		bus.Subscribe("sessions", h.SessionSubscriber())
+		bus.Subscribe("webhooks", h.WebhookSubscriber())
+		bus.Subscribe("live", h.LiveSubscriber())
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			store.WatchChanges(workerCtx, bus)
+		}()
+	}
+	if cfg.App.DevMode {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			render.Watch(workerCtx, "templates", time.Second)
+		}()
+	}
+	defer func() {
+		stopWorkers()
+		workers.Wait()
+		slog.Info("background workers stopped")
+	}()
+
+	server := &http.Server{
+		Addr:              cfg.HTTP.Addr,
+		Handler:           routes(h, health, assets, cfg.App),
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		ReadHeaderTimeout: cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+	}
+	// Event streams never go idle, Shutdown would wait for them until its timeout
+	server.RegisterOnShutdown(h.CloseStreams)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("application running", "addr", cfg.HTTP.Addr, "base_url", cfg.HTTP.BaseURL)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// The server is already answering probes while the schema is set up and data is seeded
+	if err := store.InitSchema(); err != nil {
+		_ = server.Close()
+		return fmt.Errorf("failed to set up MongoDB schema: %w", err)
+	}
+	store.InitData(cfg.Admin, hasher)
+	startupDone.Store(true)
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("HTTP server failed: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, draining in-flight requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("HTTP shutdown: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"go2/config"
+	"go2/csrf"
+	"go2/flash"
+	"go2/handler"
+	"go2/logging"
+	"go2/metrics"
+	"go2/middleware"
+	"go2/render"
+	"go2/router"
+	"go2/static"
+	"net/http"
+)
+
+func routes(h *handler.Handler, health *handler.Health, assets *static.Assets, app config.AppConfig) http.Handler {
+	r := router.New()
+
+	// The request ID is assigned first so every later log line and Mongo call carries it.
+	// metrics must stay last, it reads the matched pattern from the request the mux sees.
+	r.Use(logging.Middleware, middleware.Recover, middleware.Maintenance(app.MaintenanceOn), csrf.Protect, flash.Middleware,
+		metrics.Middleware)
+
+	// Branded pages instead of the plain text ones, JSON for API clients
+	r.NotFound(errorPage(http.StatusNotFound))
+	r.MethodNotAllowed(errorPage(http.StatusMethodNotAllowed))
+	csrf.Failure = errorPage(http.StatusForbidden)
+
+	r.Handle("GET "+static.Prefix, assets.Handler())
+
+	// Probes for the orchestrator, never behind the login
+	ops := r.Group("")
+	ops.Get("/healthz", health.Healthz)
+	ops.Get("/readyz", health.Readyz)
+	ops.Get("/version", handler.Version)
+	ops.Handle("GET /metrics", metrics.Handler())
+
+	public := r.Group("")
+	public.Get("/{$}", h.LoginFormHandler)
+	public.Post("/{$}", h.LoginHandler)
+	public.Get("/forgot", h.ForgotPasswordFormHandler)
+	public.Post("/forgot", h.ForgotPasswordHandler)
+	public.Get("/reset", h.ResetFormHandler)
+	public.Post("/reset", h.ResetHandler)
+	public.Post("/logout", h.LogoutHandler)
+	public.Get("/verify", h.VerifyEmailHandler)
+
+	// Protected routes
+	admin := r.Group("", handler.RequireLogin)
+	admin.Get("/home", h.HomeHandler)
+	admin.Get("/events/users", h.UserEventsHandler)
+	admin.Get("/dashboard", h.DashboardHandler)
+	admin.Get("/users/new", h.RegisterFormHandler)
+	admin.Post("/users", h.RegisterHandler)
+	admin.Get("/users/{id}/edit", h.EditHandler)
+	admin.Post("/users/{id}", h.UpdateHandler)
+	admin.Post("/users/{id}/delete", h.DeleteHandler)
+	admin.Post("/users/{id}/verification", h.ResendVerificationHandler)
+	admin.Get("/emails", h.EmailsHandler)
+	admin.Post("/emails/{id}/resend", h.ResendEmailHandler)
+	admin.Get("/emails/preview", h.EmailPreviewHandler)
+	admin.Get("/reports", h.ReportsHandler)
+	admin.Post("/reports", h.CreateReportHandler)
+	admin.Post("/reports/{id}/delete", h.DeleteReportHandler)
+	admin.Post("/reports/{id}/run", h.RunReportHandler)
+	admin.Get("/reports/files/{id}", h.ReportFileHandler)
+	admin.Get("/webhooks", h.WebhooksHandler)
+	admin.Post("/webhooks", h.CreateWebhookHandler)
+	admin.Post("/webhooks/{id}/delete", h.DeleteWebhookHandler)
+	admin.Post("/webhooks/deliveries/{id}/redeliver", h.RedeliverHandler)
+
+	// End-user portal, its session never opens the admin pages above
+	account := r.Group("/account")
+	account.Get("/login", h.AccountLoginFormHandler)
+	account.Post("/login", h.AccountLoginHandler)
+	account.Get("/forgot", h.AccountForgotFormHandler)
+	account.Post("/forgot", h.AccountForgotHandler)
+	account.Get("/reset", h.AccountResetFormHandler)
+	account.Post("/reset", h.AccountResetHandler)
+	account.Post("/logout", h.AccountLogoutHandler)
+
+	me := r.Group("/account", h.RequireUserLogin)
+	me.Get("/{$}", h.ProfileHandler)
+	me.Get("/profile", h.ProfileEditFormHandler)
+	me.Post("/profile", h.ProfileUpdateHandler)
+	me.Get("/password", h.PasswordFormHandler)
+	me.Post("/password", h.PasswordHandler)
+
+	api := r.Group("/api", handler.RequireAPILogin)
+	api.Get("/users", h.APIUsersHandler)
+	api.Get("/users/{id}", h.APIUserHandler)
+
+	return r
+}
+
+func errorPage(status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		render.Error(w, r, status, "")
+	})
+}
@@ -0,0 +1,90 @@
+// Package static embeds the stylesheets and serves them under fingerprinted URLs, so browsers
+// may cache them for a year and still get a new file after every change.
+package static
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+//go:embed *.css
+var Files embed.FS
+
+// Prefix is the URL path the assets are served under
+const Prefix = "/static/"
+
+// Assets maps file names to fingerprinted names, e.g. Home.css to Home.1a2b3c4d.css
+type Assets struct {
+	fsys        fs.FS
+	fingerprint bool
+	hashed      map[string]string // name -> fingerprinted name
+	original    map[string]string // fingerprinted name -> name
+}
+
+// New hashes every file of fsys. Without fingerprint, as in dev mode where files change on
+// disk, URLs keep the plain name and are never cached.
+func New(fsys fs.FS, fingerprint bool) (*Assets, error) {
+	a := &Assets{
+		fsys:        fsys,
+		fingerprint: fingerprint,
+		hashed:      make(map[string]string),
+		original:    make(map[string]string),
+	}
+	if !fingerprint {
+		return a, nil
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		ext := path.Ext(name)
+		hashedName := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:4]) + ext
+		a.hashed[name] = hashedName
+		a.original[hashedName] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// URL returns the path to link an asset from a page
+func (a *Assets) URL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if hashedName, ok := a.hashed[name]; ok {
+		return Prefix + hashedName
+	}
+	return Prefix + name
+}
+
+// Handler serves the assets, it is mounted at Prefix
+func (a *Assets) Handler() http.Handler {
+	files := http.FileServerFS(a.fsys)
+	return http.StripPrefix(Prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// In dev mode fsys is the package directory on disk, only what is embedded is served
+		if path.Ext(r.URL.Path) != ".css" {
+			http.NotFound(w, r)
+			return
+		}
+		if name, ok := a.original[r.URL.Path]; ok {
+			// The name changes with the content, so the file can be cached forever
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			r.URL.Path = name
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		files.ServeHTTP(w, r)
+	}))
+}
@@ -0,0 +1,7 @@
+// Package templates embeds the HTML pages and the email templates into the binary.
+package templates
+
+import "embed"
+
+//go:embed *.html email
+var Files embed.FS
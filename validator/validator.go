@@ -0,0 +1,187 @@
+package validator
+
+import (
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go2/model"
+)
+
+// Mode tells the validator which flow the user is being validated for.
+type Mode int
+
+const (
+	Create Mode = iota
+	Update
+)
+
+// Errors maps a form field name to the message shown next to it.
+type Errors map[string]string
+
+func (e Errors) Add(field, message string) {
+	// Keep the first message for a field, it is usually the most relevant one
+	if _, exists := e[field]; !exists {
+		e[field] = message
+	}
+}
+
+func (e Errors) Any() bool {
+	return len(e) > 0
+}
+
+var (
+	mobilePattern = regexp.MustCompile(`^(\+\d{1,3})?\d{10}$`)
+	validGenders  = map[string]bool{"male": true, "female": true}
+	validSports   = map[string]bool{"basketball": true, "swimming": true, "cricket": true}
+	validEvents   = map[string]bool{
+		model.EventUserCreated: true, model.EventUserUpdated: true, model.EventUserDeleted: true, model.EventAdminLogin: true,
+	}
+)
+
+// ValidateUser checks every field of the user and returns all the problems at once.
+// countries is the list of allowed countries, an empty list skips the country check.
+func ValidateUser(user model.User, mode Mode, countries []string) Errors {
+	errs := Errors{}
+
+	if strings.TrimSpace(user.Username) == "" {
+		errs.Add("username", "Name is required")
+	}
+
+	email := strings.TrimSpace(user.Email)
+	if email == "" {
+		errs.Add("email", "Email is required")
+	} else if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		errs.Add("email", "Invalid email address")
+	}
+
+	if !mobilePattern.MatchString(user.Mobile) {
+		errs.Add("mobile", "Invalid mobile number format")
+	}
+
+	// Password is only set when creating, the edit form never changes it
+	if mode == Create && user.Password == "" {
+		errs.Add("password", "Password is required")
+	}
+
+	if strings.TrimSpace(user.Address) == "" {
+		errs.Add("address", "Address is required")
+	}
+
+	if !validGenders[user.Gender] {
+		errs.Add("gender", "Select a gender")
+	}
+
+	for _, sport := range splitSports(user.Sports) {
+		if !validSports[sport] {
+			errs.Add("sports", "Unknown sport: "+sport)
+		}
+	}
+
+	dob, err := time.Parse("2006-01-02", user.DOB)
+	if err != nil || dob.After(time.Now()) {
+		errs.Add("dob", "Invalid or future DOB")
+	}
+
+	if user.Country != "" && len(countries) > 0 && !contains(countries, user.Country) {
+		errs.Add("country", "Select a country from the list")
+	}
+
+	return errs
+}
+
+// ConfirmPassword adds an error when the confirmation does not match the password.
+func ConfirmPassword(errs Errors, password, confirm string) {
+	if password != confirm {
+		errs.Add("confirm", "Passwords do not match")
+	}
+}
+
+func splitSports(sports string) []string {
+	var out []string
+	for _, s := range strings.Split(sports, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// maxRecipients limits how many people a single report is mailed to
+const maxRecipients = 20
+
+// ValidateReportSchedule checks a schedule from the admin form.
+func ValidateReportSchedule(s model.ReportSchedule) Errors {
+	errs := Errors{}
+
+	if strings.TrimSpace(s.Name) == "" {
+		errs.Add("name", "Name is required")
+	}
+
+	if s.Kind != model.ReportNewUsersByCountry && s.Kind != model.ReportUserExport {
+		errs.Add("kind", "Select a report")
+	}
+
+	switch s.Frequency {
+	case model.FrequencyDaily:
+	case model.FrequencyWeekly:
+		if s.Weekday < time.Sunday || s.Weekday > time.Saturday {
+			errs.Add("weekday", "Select a day of the week")
+		}
+	default:
+		errs.Add("frequency", "Select daily or weekly")
+	}
+
+	if s.Hour < 0 || s.Hour > 23 {
+		errs.Add("hour", "Hour must be between 0 and 23")
+	}
+
+	switch {
+	case len(s.Recipients) == 0:
+		errs.Add("recipients", "At least one recipient is required")
+	case len(s.Recipients) > maxRecipients:
+		errs.Add("recipients", "A report can have at most 20 recipients")
+	}
+	for _, r := range s.Recipients {
+		if addr, err := mail.ParseAddress(r); err != nil || addr.Address != r {
+			errs.Add("recipients", "Invalid email address: "+r)
+		}
+	}
+
+	return errs
+}
+
+// ValidateWebhook checks an endpoint from the admin form.
+func ValidateWebhook(w model.Webhook) Errors {
+	errs := Errors{}
+
+	u, err := url.Parse(strings.TrimSpace(w.URL))
+	switch {
+	case w.URL == "":
+		errs.Add("url", "URL is required")
+	case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+		errs.Add("url", "Enter an http or https URL")
+	}
+
+	if len(w.Events) == 0 {
+		errs.Add("events", "Select at least one event")
+	}
+	for _, e := range w.Events {
+		if !validEvents[e] {
+			errs.Add("events", "Unknown event: "+e)
+		}
+	}
+
+	return errs
+}
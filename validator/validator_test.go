@@ -0,0 +1,117 @@
+package validator
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"go2/model"
+)
+
+var countries = []string{"INDIA", "FRANCE"}
+
+func validUser() model.User {
+	return model.User{
+		Username: "Jane",
+		Email:    "jane@example.com",
+		Mobile:   "9876543210",
+		Password: "hashed",
+		Address:  "1 Main Street",
+		Gender:   "female",
+		Sports:   "cricket,swimming",
+		DOB:      "1990-05-17",
+		Country:  "INDIA",
+	}
+}
+
+func TestValidateUser(t *testing.T) {
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+
+	tests := []struct {
+		name       string
+		change     func(*model.User)
+		want       Errors // in both modes
+		wantCreate Errors // replaces want in Create mode when set
+	}{
+		{"valid", func(u *model.User) {}, Errors{}, nil},
+		{"blank name", func(u *model.User) { u.Username = "  " }, Errors{"username": "Name is required"}, nil},
+		{"no email", func(u *model.User) { u.Email = "" }, Errors{"email": "Email is required"}, nil},
+		{"invalid email", func(u *model.User) { u.Email = "jane@" }, Errors{"email": "Invalid email address"}, nil},
+		{"email with a name", func(u *model.User) { u.Email = "Jane <jane@example.com>" }, Errors{"email": "Invalid email address"}, nil},
+		{"short mobile", func(u *model.User) { u.Mobile = "98765" }, Errors{"mobile": "Invalid mobile number format"}, nil},
+		{"mobile with letters", func(u *model.User) { u.Mobile = "98765abcde" }, Errors{"mobile": "Invalid mobile number format"}, nil},
+		{"mobile with country code", func(u *model.User) { u.Mobile = "+919876543210" }, Errors{}, nil},
+		{"no password", func(u *model.User) { u.Password = "" }, Errors{}, Errors{"password": "Password is required"}},
+		{"blank address", func(u *model.User) { u.Address = " " }, Errors{"address": "Address is required"}, nil},
+		{"no gender", func(u *model.User) { u.Gender = "" }, Errors{"gender": "Select a gender"}, nil},
+		{"unknown gender", func(u *model.User) { u.Gender = "other" }, Errors{"gender": "Select a gender"}, nil},
+		{"no sports", func(u *model.User) { u.Sports = "" }, Errors{}, nil},
+		{"unknown sport", func(u *model.User) { u.Sports = "cricket, chess" }, Errors{"sports": "Unknown sport: chess"}, nil},
+		{"first unknown sport kept", func(u *model.User) { u.Sports = "chess,golf" }, Errors{"sports": "Unknown sport: chess"}, nil},
+		{"bad DOB", func(u *model.User) { u.DOB = "17/05/1990" }, Errors{"dob": "Invalid or future DOB"}, nil},
+		{"future DOB", func(u *model.User) { u.DOB = tomorrow }, Errors{"dob": "Invalid or future DOB"}, nil},
+		{"unknown country", func(u *model.User) { u.Country = "ATLANTIS" }, Errors{"country": "Select a country from the list"}, nil},
+		{"no country", func(u *model.User) { u.Country = "" }, Errors{}, nil},
+	}
+	for _, tt := range tests {
+		for _, mode := range []Mode{Create, Update} {
+			want := tt.want
+			if mode == Create && tt.wantCreate != nil {
+				want = tt.wantCreate
+			}
+			user := validUser()
+			tt.change(&user)
+			if got := ValidateUser(user, mode, countries); !maps.Equal(got, want) {
+				t.Errorf("%s, mode %d: got %v, want %v", tt.name, mode, got, want)
+			}
+		}
+	}
+}
+
+func TestValidateUserCountryList(t *testing.T) {
+	user := validUser()
+	user.Country = "ATLANTIS"
+	if errs := ValidateUser(user, Update, nil); errs.Any() {
+		t.Errorf("without a country list: %v", errs)
+	}
+}
+
+func TestValidateUserAllErrors(t *testing.T) {
+	errs := ValidateUser(model.User{Sports: "chess", DOB: "never", Country: "ATLANTIS"}, Create, countries)
+	want := Errors{
+		"username": "Name is required",
+		"email":    "Email is required",
+		"mobile":   "Invalid mobile number format",
+		"password": "Password is required",
+		"address":  "Address is required",
+		"gender":   "Select a gender",
+		"sports":   "Unknown sport: chess",
+		"dob":      "Invalid or future DOB",
+		"country":  "Select a country from the list",
+	}
+	if !maps.Equal(errs, want) {
+		t.Errorf("got %v, want %v", errs, want)
+	}
+}
+
+func TestConfirmPassword(t *testing.T) {
+	tests := []struct {
+		name              string
+		password, confirm string
+		errs, want        Errors
+	}{
+		{"match", "Secret#123", "Secret#123", Errors{}, Errors{}},
+		{"mismatch", "Secret#123", "Secret#124", Errors{}, Errors{"confirm": "Passwords do not match"}},
+		{"empty confirmation", "Secret#123", "", Errors{}, Errors{"confirm": "Passwords do not match"}},
+		{"added to earlier errors", "a", "b", Errors{"username": "Name is required"},
+			Errors{"username": "Name is required", "confirm": "Passwords do not match"}},
+		{"earlier confirm message kept", "a", "b", Errors{"confirm": "Confirm your password"},
+			Errors{"confirm": "Confirm your password"}},
+	}
+	for _, tt := range tests {
+		ConfirmPassword(tt.errs, tt.password, tt.confirm)
+		if !maps.Equal(tt.errs, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.errs, tt.want)
+		}
+	}
+}
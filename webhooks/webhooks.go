@@ -0,0 +1,118 @@
+// Package webhooks queues user lifecycle events for the registered endpoints and delivers
+// them as signed JSON POST requests.
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go2/model"
+	"go2/repository"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Events lists every event an endpoint can subscribe to
+var Events = []string{model.EventUserCreated, model.EventUserUpdated, model.EventUserDeleted, model.EventAdminLogin}
+
+// Headers sent with every delivery
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Envelope is the JSON body of a delivery
+type Envelope struct {
+	ID        string    `json:"id"` // the same for every endpoint that receives the event
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// Publisher queues events, the Worker sends them
+type Publisher struct {
+	webhooks   repository.WebhookRepository
+	deliveries repository.DeliveryRepository
+}
+
+func NewPublisher(webhooks repository.WebhookRepository, deliveries repository.DeliveryRepository) *Publisher {
+	return &Publisher{webhooks: webhooks, deliveries: deliveries}
+}
+
+// Publish queues one delivery per endpoint subscribed to event.
+func (p *Publisher) Publish(ctx context.Context, event string, data any) error {
+	return p.PublishID(ctx, primitive.NewObjectID().Hex(), event, data)
+}
+
+// PublishID is Publish with the envelope ID chosen by the caller, so an event that is
+// published again carries the same ID and receivers can drop the duplicate.
+func (p *Publisher) PublishID(ctx context.Context, id, event string, data any) error {
+	hooks, err := p.webhooks.ListForEvent(ctx, event)
+	if err != nil || len(hooks) == 0 {
+		return err
+	}
+
+	now := time.Now().UTC()
+	body, err := json.Marshal(Envelope{ID: id, Event: event, CreatedAt: now, Data: data})
+	if err != nil {
+		return fmt.Errorf("webhooks: encoding %s: %w", event, err)
+	}
+
+	var errs []error
+	for _, hook := range hooks {
+		errs = append(errs, p.deliveries.Insert(ctx, model.WebhookDelivery{
+			WebhookID:     hook.ID,
+			URL:           hook.URL,
+			Event:         event,
+			Payload:       string(body),
+			Status:        model.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+// NewSecret returns a random signing key for a new endpoint
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value for a body sent at timestamp (Unix seconds).
+// The timestamp is signed too, so a captured request cannot be replayed later.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a delivery, for receivers written in Go.
+// Requests older than tolerance are rejected.
+func Verify(secret, timestamp, signature string, body []byte, tolerance time.Duration) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("webhooks: invalid timestamp")
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return errors.New("webhooks: timestamp outside the tolerance")
+	}
+	if !hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature)) {
+		return errors.New("webhooks: signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"go2/model"
+	"go2/repository/memory"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"event":"user.created"}`)
+	now := time.Now().Unix()
+	sig := Sign("secret", now, body)
+	ts := strconv.FormatInt(now, 10)
+
+	if err := Verify("secret", ts, sig, body, time.Minute); err != nil {
+		t.Fatalf("valid signature: %v", err)
+	}
+	tests := []struct {
+		name, secret, ts, sig string
+		body                  []byte
+	}{
+		{"other secret", "other", ts, sig, body},
+		{"changed body", "secret", ts, sig, []byte(`{"event":"user.deleted"}`)},
+		{"changed timestamp", "secret", strconv.FormatInt(now+1, 10), sig, body},
+		{"old timestamp", "secret", strconv.FormatInt(now-120, 10), Sign("secret", now-120, body), body},
+		{"bad timestamp", "secret", "yesterday", sig, body},
+	}
+	for _, tt := range tests {
+		if err := Verify(tt.secret, tt.ts, tt.sig, tt.body, time.Minute); err == nil {
+			t.Errorf("%s: verified", tt.name)
+		}
+	}
+}
+
+func newTestWorker() (*Worker, *memory.WebhookRepository, *memory.DeliveryRepository) {
+	hooks := memory.NewWebhookRepository()
+	deliveries := memory.NewDeliveryRepository()
+	w := NewWorker(hooks, deliveries)
+	w.BaseDelay = 0 // a failed delivery is due again at once
+	w.MaxAttempts = 3
+	return w, hooks, deliveries
+}
+
+func onlyDelivery(t *testing.T, deliveries *memory.DeliveryRepository) model.WebhookDelivery {
+	t.Helper()
+	list, err := deliveries.List(context.Background(), primitive.NilObjectID, 10)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("got %d deliveries, %v", len(list), err)
+	}
+	return list[0]
+}
+
+func TestWorkerRetriesUntilDelivered(t *testing.T) {
+	const secret = "whsec_test"
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := Verify(secret, r.Header.Get(TimestampHeader), r.Header.Get(SignatureHeader), body, time.Minute); err != nil {
+			t.Errorf("receiver: %v", err)
+		}
+		var env Envelope
+		if err := json.Unmarshal(body, &env); err != nil || env.Event != model.EventUserCreated {
+			t.Errorf("receiver got %s, %v", body, err)
+		}
+		if calls.Add(1) == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	w, hooks, deliveries := newTestWorker()
+	ctx := context.Background()
+	if err := hooks.Insert(ctx, model.Webhook{URL: receiver.URL, Events: []string{model.EventUserCreated}, Secret: secret}); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewPublisher(hooks, deliveries).Publish(ctx, model.EventUserCreated, map[string]string{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !w.processOne(ctx) {
+		t.Fatal("nothing to deliver")
+	}
+	d := onlyDelivery(t, deliveries)
+	if d.Status != model.DeliveryPending || d.Attempts != 1 || d.ResponseCode != http.StatusServiceUnavailable {
+		t.Fatalf("after the failure: status %s, attempts %d, code %d", d.Status, d.Attempts, d.ResponseCode)
+	}
+
+	if !w.processOne(ctx) {
+		t.Fatal("failed delivery not retried")
+	}
+	d = onlyDelivery(t, deliveries)
+	if d.Status != model.DeliveryDelivered || d.Attempts != 2 || d.ResponseCode != http.StatusOK {
+		t.Fatalf("after the retry: status %s, attempts %d, code %d", d.Status, d.Attempts, d.ResponseCode)
+	}
+	if w.processOne(ctx) {
+		t.Error("delivered event sent again")
+	}
+}
+
+func TestWorkerGivesUp(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	w, hooks, deliveries := newTestWorker()
+	ctx := context.Background()
+	hooks.Insert(ctx, model.Webhook{URL: receiver.URL, Events: []string{model.EventUserDeleted}, Secret: "s"})
+	NewPublisher(hooks, deliveries).Publish(ctx, model.EventUserDeleted, nil)
+
+	for w.processOne(ctx) {
+	}
+	if d := onlyDelivery(t, deliveries); d.Status != model.DeliveryDead || d.Attempts != w.MaxAttempts {
+		t.Errorf("status %s after %d attempts, want dead after %d", d.Status, d.Attempts, w.MaxAttempts)
+	}
+}
+
+func TestWorkerStopsForDeletedEndpoint(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer receiver.Close()
+
+	w, hooks, deliveries := newTestWorker()
+	ctx := context.Background()
+	hooks.Insert(ctx, model.Webhook{URL: receiver.URL, Events: []string{model.EventUserUpdated}, Secret: "s"})
+	NewPublisher(hooks, deliveries).Publish(ctx, model.EventUserUpdated, nil)
+	hook := onlyDelivery(t, deliveries).WebhookID
+	if err := hooks.Delete(ctx, hook); err != nil {
+		t.Fatal(err)
+	}
+
+	w.processOne(ctx)
+	if d := onlyDelivery(t, deliveries); d.Status != model.DeliveryDead || calls.Load() != 0 {
+		t.Errorf("status %s with %d requests, want dead and none", d.Status, calls.Load())
+	}
+}
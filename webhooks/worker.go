@@ -0,0 +1,153 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go2/model"
+	"go2/repository"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Worker delivers queued events with exponential backoff between attempts, like the email outbox.
+type Worker struct {
+	Webhooks     repository.WebhookRepository
+	Deliveries   repository.DeliveryRepository
+	Client       *http.Client
+	PollInterval time.Duration
+	MaxAttempts  int           // after this many failures the delivery is marked dead
+	BaseDelay    time.Duration // delay after the first failure, doubled for every further one
+	MaxDelay     time.Duration
+	Timeout      time.Duration
+}
+
+func NewWorker(webhooks repository.WebhookRepository, deliveries repository.DeliveryRepository) *Worker {
+	return &Worker{
+		Webhooks:   webhooks,
+		Deliveries: deliveries,
+		Client: &http.Client{
+			// A redirect is reported as a failure instead of posting the payload somewhere else
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		PollInterval: 2 * time.Second,
+		MaxAttempts:  8,
+		BaseDelay:    30 * time.Second,
+		MaxDelay:     2 * time.Hour,
+		Timeout:      10 * time.Second,
+	}
+}
+
+// Run polls for due deliveries until ctx is cancelled, then returns after the current one.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for w.processOne(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processOne sends a single due delivery and reports whether there was one.
+func (w *Worker) processOne(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	now := time.Now()
+	delivery, err := w.Deliveries.Claim(ctx, now, now.Add(w.Timeout*2))
+	if errors.Is(err, repository.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "webhooks: failed to claim delivery", "error", err)
+		return false
+	}
+
+	// A delivery that is already being sent is finished even during shutdown
+	ctx = context.WithoutCancel(ctx)
+	code, err := w.send(ctx, delivery)
+
+	attempts := delivery.Attempts + 1
+	if err == nil {
+		if err := w.Deliveries.MarkDelivered(ctx, delivery.ID, attempts, code); err != nil {
+			slog.ErrorContext(ctx, "webhooks: failed to mark delivery as delivered", "delivery_id", delivery.ID.Hex(), "error", err)
+		}
+		return true
+	}
+
+	status := model.DeliveryPending
+	if attempts >= w.MaxAttempts || errors.Is(err, errEndpointGone) {
+		status = model.DeliveryDead
+	}
+	slog.WarnContext(ctx, "webhooks: delivery failed",
+		"delivery_id", delivery.ID.Hex(), "url", delivery.URL, "attempt", attempts, "status", status, "error", err)
+	next := time.Now().Add(w.backoff(attempts))
+	if err := w.Deliveries.MarkFailed(ctx, delivery.ID, status, attempts, code, next, err.Error()); err != nil {
+		slog.ErrorContext(ctx, "webhooks: failed to record attempt", "delivery_id", delivery.ID.Hex(), "error", err)
+	}
+	return true
+}
+
+// errEndpointGone stops the retries of deliveries whose endpoint was deleted
+var errEndpointGone = errors.New("webhook endpoint was deleted")
+
+// send posts the payload and returns the response status code, any status outside 2xx is an error.
+func (w *Worker) send(ctx context.Context, delivery model.WebhookDelivery) (int, error) {
+	// The secret is read at send time, so deleting an endpoint stops its pending deliveries
+	hook, err := w.Webhooks.FindByID(ctx, delivery.WebhookID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return 0, errEndpointGone
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go2-webhooks/1.0")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID.Hex())
+	req.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, ts, body))
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little so the connection can be reused, the body itself is not stored
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.BaseDelay
+	for i := 1; i < attempts && delay < w.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, w.MaxDelay)
+}